@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"drcom-go/pkg/config"
+	"drcom-go/pkg/drcom"
+	"github.com/fatih/color"
+)
+
+// newDriver builds the configured portal driver.
+func newDriver(cfg *config.Config) (drcom.PortalDriver, error) {
+	return drcom.NewDriver(cfg.Auth.Driver, drcom.DriverConfig{
+		Host:     primaryHost(cfg),
+		Username: cfg.Auth.Username,
+		Password: cfg.Auth.Password,
+		Options:  clientOptions(cfg),
+		Settings: cfg.Auth.Settings,
+
+		Interface: cfg.Auth.Interface,
+		IP:        cfg.Auth.IP,
+		MAC:       cfg.Auth.MAC,
+	})
+}
+
+// primaryHost is the first of auth.hosts, or auth.host.
+func primaryHost(cfg *config.Config) string {
+	if len(cfg.Auth.Hosts) > 0 {
+		return cfg.Auth.Hosts[0]
+	}
+	return cfg.Auth.Host
+}
+
+// clientOptions translates the configuration into HTTP client options.
+func clientOptions(cfg *config.Config) []drcom.Option {
+	var opts []drcom.Option
+	profile, err := portalProfile(cfg)
+	if err != nil {
+		color.Yellow("⚠️ %v，使用默认配置", err)
+		profile = drcom.DefaultProfile
+	}
+	opts = append(opts, drcom.WithProfile(profile))
+	if len(cfg.Auth.Hosts) > 0 {
+		opts = append(opts, drcom.WithHosts(cfg.Auth.Hosts...))
+	}
+	if conf := portalTLS(cfg); conf != nil {
+		opts = append(opts, drcom.WithTLS(conf))
+	}
+	if cfg.Auth.PersistCookies {
+		jar, err := drcom.NewFileJar(filepath.Join(cfg.StateDir, "cookies.json"))
+		if err != nil {
+			color.Yellow("⚠️ 读取 Cookie 文件失败，本次不保存 Cookie: %v", err)
+		} else {
+			opts = append(opts, drcom.WithCookieJar(jar))
+		}
+	}
+	if steps := preLoginSteps(cfg); len(steps) > 0 {
+		opts = append(opts, drcom.WithPreLogin(steps...))
+	}
+	if cfg.Auth.Timeout > 0 {
+		opts = append(opts, drcom.WithTimeout(time.Duration(cfg.Auth.Timeout)*time.Second))
+	}
+	if cfg.Auth.Interface != "" {
+		opts = append(opts, drcom.WithInterface(cfg.Auth.Interface))
+	}
+	if cfg.Auth.IP != "" {
+		opts = append(opts, drcom.WithIP(cfg.Auth.IP))
+	}
+	if cfg.Auth.IPv6 != "" {
+		opts = append(opts, drcom.WithIPv6(cfg.Auth.IPv6))
+	}
+	opts = append(opts, drcom.WithIPMode(ipMode(cfg)))
+	if cfg.Auth.MAC != "" {
+		mac, err := drcom.ParseMAC(cfg.Auth.MAC)
+		if err != nil {
+			color.Yellow("⚠️ 忽略无效的 auth.mac: %v", err)
+		} else {
+			opts = append(opts, drcom.WithMAC(mac))
+		}
+	}
+	if flagDebug {
+		opts = append(opts, drcom.WithLogger(log.New(os.Stderr, "[drcom] ", log.LstdFlags)))
+	}
+	if len(cfg.Auth.ACParams) > 0 {
+		opts = append(opts, drcom.WithACParams(cfg.Auth.ACParams))
+	}
+	if rules := outcomeRules(cfg); len(rules) > 0 {
+		opts = append(opts, drcom.WithOutcomeRules(rules...))
+	}
+	return opts
+}
+
+var insecureWarning sync.Once
+
+// portalTLS builds the TLS configuration for the portal from auth.tls.
+func portalTLS(cfg *config.Config) *tls.Config {
+	t := cfg.Auth.TLS
+	if t.InsecureSkipVerify {
+		insecureWarning.Do(func() {
+			color.Red("⚠️⚠️ 警告: 已启用 auth.tls.insecure_skip_verify，不再校验认证服务器证书！")
+			color.Red("⚠️⚠️ 账号密码可能被中间人截获，请尽快改用 ca_file 或 pin_sha256。")
+		})
+	}
+	conf, err := drcom.TLSOptions{
+		CAFile:             t.CAFile,
+		Pins:               t.PinSHA256,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}.Config()
+	if err != nil {
+		color.Yellow("⚠️ 忽略无效的 auth.tls 配置: %v", err)
+		return nil
+	}
+	return conf
+}
+
+// checker builds the connectivity checker. Probes go to public sites, so
+// the portal's certificate pins are not applied to them.
+func checker(cfg *config.Config) drcom.Checker {
+	t := cfg.Auth.TLS
+	conf, err := drcom.TLSOptions{CAFile: t.CAFile, InsecureSkipVerify: t.InsecureSkipVerify}.Config()
+	if err != nil {
+		conf = nil
+	}
+	return drcom.Checker{Interface: cfg.Auth.Interface, TLS: conf}
+}
+
+// portalProfile resolves portal.preset and applies the per-field overrides.
+func portalProfile(cfg *config.Config) (drcom.Profile, error) {
+	p := cfg.Portal
+	base, err := drcom.LookupProfile(p.Preset)
+	if err != nil {
+		return base, err
+	}
+	override := drcom.Profile{
+		LoginPath:       p.LoginPath,
+		LogoutPath:      p.LogoutPath,
+		StatusPath:      p.StatusPath,
+		AccountTemplate: p.AccountTemplate,
+		LoginMethod:     p.LoginMethod,
+		JSVersion:       p.JSVersion,
+		TerminalType:    p.TerminalType,
+		Lang:            p.Lang,
+		IsLogin:         p.IsLogin,
+		Extra:           p.Extra,
+		Callback:        p.Callback,
+		CallbackName:    p.CallbackName,
+		Encryption:      p.Encryption,
+		RSAModulus:      p.RSAModulus,
+		RSAExponent:     p.RSAExponent,
+		PublicKey:       p.PublicKey,
+		MD5Salt:         p.MD5Salt,
+
+		LogoutAccountTemplate: p.LogoutTemplate,
+		StatusLang:            p.StatusLang,
+	}
+	for key, name := range p.Params {
+		switch key {
+		case "callback":
+			override.Names.Callback = name
+		case "account":
+			override.Names.Account = name
+		case "password":
+			override.Names.Password = name
+		case "ip":
+			override.Names.IP = name
+		case "ipv6":
+			override.Names.IPv6 = name
+		case "encrypt":
+			override.Names.Encrypt = name
+		case "mac":
+			override.Names.MAC = name
+		case "login_method":
+			override.Names.LoginMethod = name
+		case "js_version":
+			override.Names.JSVersion = name
+		case "terminal_type":
+			override.Names.TerminalType = name
+		case "lang":
+			override.Names.Lang = name
+		case "is_login":
+			override.Names.IsLogin = name
+		default:
+			return base, fmt.Errorf("未知的 portal.params 键 %q", key)
+		}
+	}
+	return base.Merge(override), nil
+}
+
+func preLoginSteps(cfg *config.Config) []drcom.PreLoginStep {
+	var steps []drcom.PreLoginStep
+	for _, s := range cfg.Portal.PreLogin {
+		step := drcom.PreLoginStep{URL: s.URL}
+		for _, r := range s.Extract {
+			step.Extract = append(step.Extract, drcom.TokenRule{Name: r.Name, Regex: r.Regex, JSONPath: r.JSONPath})
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// ipMode parses auth.ip_mode, falling back to IPv4 on bad input.
+func ipMode(cfg *config.Config) drcom.IPMode {
+	m, err := drcom.ParseIPMode(cfg.Auth.IPMode)
+	if err != nil {
+		color.Yellow("⚠️ 忽略无效的 auth.ip_mode: %v", err)
+	}
+	return m
+}
+
+func outcomeRules(cfg *config.Config) []drcom.OutcomeRule {
+	var rules []drcom.OutcomeRule
+	for _, r := range cfg.Auth.Outcomes {
+		o, err := drcom.ParseOutcome(r.Outcome)
+		if err != nil {
+			color.Yellow("⚠️ 忽略无效的 auth.outcomes 配置: %v", err)
+			continue
+		}
+		rules = append(rules, drcom.OutcomeRule{RetCode: r.RetCode, Msg: r.Msg, Outcome: o})
+	}
+	return rules
+}
+
+// requestErrText describes a failed portal request, singling out HTML
+// answers so maintenance pages are not mistaken for network trouble.
+func requestErrText(err error) string {
+	switch {
+	case errors.Is(err, drcom.ErrMaintenance):
+		return fmt.Sprintf("认证服务器正在维护 (%v)", err)
+	case errors.Is(err, drcom.ErrHTMLPage):
+		return fmt.Sprintf("认证服务器返回了网页而不是数据，可能被重定向或接口已变更 (%v)", err)
+	case errors.Is(err, drcom.ErrNotLocalSession):
+		return "该认证协议的会话只存在于登录它的进程中 (如 drcom daemon)，无法在这里查询或注销；需要时请改用 drcom server 的 /api/status 和 /api/logout"
+	}
+	return err.Error()
+}
+
+// outcomeText describes a login outcome for terminal output.
+func outcomeText(o drcom.LoginOutcome) string {
+	switch o {
+	case drcom.OutcomeSuccess:
+		return "登录成功"
+	case drcom.OutcomeAlreadyOnline:
+		return "已经在线"
+	case drcom.OutcomeWrongPassword:
+		return "账号或密码错误"
+	case drcom.OutcomeAccountArrears:
+		return "账号欠费"
+	case drcom.OutcomeAccountDisabled:
+		return "账号已停用"
+	case drcom.OutcomeTooManyDevices:
+		return "在线设备数已达上限"
+	case drcom.OutcomeRateLimited:
+		return "请求过于频繁"
+	case drcom.OutcomePortalError:
+		return "认证服务器错误"
+	default:
+		return "未知结果"
+	}
+}
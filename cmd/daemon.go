@@ -1,14 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"drcom-go/pkg/config"
 	"drcom-go/pkg/drcom"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var daemonCmd = &cobra.Command{
@@ -26,61 +32,181 @@ var daemonCmd = &cobra.Command{
 			return
 		}
 
-		client := drcom.NewClient(cfg.Auth.Host, cfg.Auth.Username, cfg.Auth.Password)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		driver, err := newDriver(cfg)
+		if err != nil {
+			color.Red("初始化认证驱动失败: %v", err)
+			return
+		}
         interval := time.Duration(cfg.Daemon.Interval) * time.Second
         if interval == 0 {
             interval = 60 * time.Second
         }
 
 		color.Cyan("🚀 守护进程已启动 (检测间隔: %v)...", interval)
-        
+
+		if flagResume {
+			if err := drcom.ClearPause(cfg.StateDir); err != nil {
+				color.Red("清除暂停状态失败: %v", err)
+			} else {
+				color.Green("已恢复自动登录。")
+			}
+		}
+		backoff := loginBackoff(cfg, interval)
+		var nextAttempt time.Time
+		paused := false
+		// held is the pause in force at the last check; unsaved is one that
+		// could not be written and holds until the daemon restarts.
+		var held, unsaved *drcom.PauseState
+		events := netEvents(ctx, cfg, drcom.NewNetlinkSource())
+		tracker := drcom.NewChangeTracker()
+
+		unit := drcom.ParseByteUnit(cfg.Alert.UnitBase)
         lastAlertTime := time.Time{}
         lastStatusLogTime := time.Time{}
 
+		// Drivers with a client-side heartbeat (UDP protocols) need a session
+		// of their own, so they log in once at startup even when online.
+		keepAliver, _ := driver.(drcom.KeepAliver)
+		needLogin := keepAliver != nil
+		var heartbeat *keepAlive
+		monitors := newMonitors(cfg, driver)
+		lastCause := drcom.CauseNone
+
 		for {
-            isOnline := drcom.CheckInternet()
-            
-            if !isOnline {
-                color.Yellow("[%s] 网络断开。正在尝试重连...", time.Now().Format("15:04:05"))
-                resp, err := client.Login()
-                if err != nil {
-                    color.Red("[错误] 登录请求失败: %v", err)
-                } else {
-                    // Check strict success
-                    success := resp.Result == "1" || resp.Result == 1 || fmt.Sprintf("%v", resp.Result) == "1"
-                    alreadyOnline := (resp.Msg != "" && strings.Contains(resp.Msg, "已经在线"))
-                    
-                    if success || alreadyOnline {
-                         // Double check internet
-                         time.Sleep(1 * time.Second) // Wait a sec for NAT/Rule propagation
-                         if drcom.CheckInternet() {
-                             color.Green("[成功] 重新连接成功: %s (且外网可达)", resp.Msg)
-                             drcom.SendWebhook(cfg.Alert.WebhookURL, "网络已重连: "+resp.Msg)
+			pause, err := drcom.LoadPause(cfg.StateDir)
+			if err != nil {
+				// The state is unknown; keep it rather than retry a bad password.
+				color.Red("读取暂停状态失败: %v", err)
+				pause = held
+			}
+			if pause == nil {
+				pause = unsaved
+			}
+			if pause != nil && !paused {
+				color.Red("[%s] 自动登录已暂停 (%s): %s", time.Now().Format("15:04:05"), outcomeText(pause.Outcome), pause.Message)
+				color.Red("  修复后运行 'drcom daemon --resume' 或调用 POST /api/resume 恢复。")
+			} else if pause == nil && paused {
+				// Pick up credentials fixed in the config file meanwhile.
+				if c, d, err := reloadDriver(); err != nil {
+					color.Red("重新加载配置失败: %v", err)
+				} else {
+					cfg, driver = c, d
+					heartbeat.Stop()
+					heartbeat = nil
+					keepAliver, _ = driver.(drcom.KeepAliver)
+					needLogin = keepAliver != nil
+					monitors = newMonitors(cfg, driver)
+				}
+				backoff.Reset()
+				nextAttempt = time.Time{}
+				color.Green("[%s] 自动登录已恢复", time.Now().Format("15:04:05"))
+			}
+			paused = pause != nil
+			held = pause
+
+			if w, ok := driver.(drcom.AddressWatcher); ok {
+				if ch := w.AddressChange(); ch != nil {
+					handoverAddress(ctx, cfg, w, ch)
+					// The old session is gone; authenticate the new address now.
+					needLogin = true
+					backoff.Reset()
+					nextAttempt = time.Time{}
+					for _, fm := range monitors {
+						fm.monitor.Reset()
+					}
+				}
+			}
+
+			state, down, results := checkState(ctx, monitors)
+			isOnline := state == drcom.StateOnline
+			cause := drcom.CauseNone
+			if !isOnline {
+				diag := diagnose(ctx, cfg, driver, state, results)
+				cause = diag.Cause
+				if cause != lastCause {
+					// Notify once per cause, not on every check.
+					drcom.SendWebhook(cfg.Alert.WebhookURL, fmt.Sprintf("网络异常: %s (%s)", causeText(diag), joinDown(down)))
+				}
+				if flagDebug && diag.Detail != "" {
+					fmt.Printf("  [诊断] %s: %s\n", diag.Cause, diag.Detail)
+				}
+				if !cause.NeedsLogin() {
+					// Logging in cannot help; wait for the link, gateway or uplink to return.
+					color.Yellow("[%s] 网络异常 (%s): %s，等待恢复...", time.Now().Format("15:04:05"), joinDown(down), causeText(diag))
+				} else if heartbeat == nil {
+					color.Yellow("[%s] 网络断开 (%s): %s。正在尝试重连...", time.Now().Format("15:04:05"), joinDown(down), causeText(diag))
+				}
+			} else if lastCause != drcom.CauseNone && !lastCause.NeedsLogin() {
+				color.Green("[%s] 网络已恢复", time.Now().Format("15:04:05"))
+				drcom.SendWebhook(cfg.Alert.WebhookURL, "网络已恢复")
+			}
+			lastCause = cause
+
+			wantLogin := needLogin || (!isOnline && heartbeat == nil && cause.NeedsLogin())
+			if wantLogin && !paused && time.Now().Before(nextAttempt) {
+				color.Yellow("[%s] 登录退避中，%s 后重试", time.Now().Format("15:04:05"), time.Until(nextAttempt).Round(time.Second))
+			}
+			if wantLogin && !paused && !time.Now().Before(nextAttempt) {
+				// A new login replaces the session the old heartbeat kept.
+				heartbeat.Stop()
+				heartbeat = nil
+				res, err := driver.Login(ctx)
+				if err != nil {
+					color.Red("[错误] 登录请求失败: %s", requestErrText(err))
+					nextAttempt = time.Now().Add(backoff.Next())
+				} else {
+					if res.Outcome.OK() {
+						needLogin = false
+						backoff.Reset()
+						nextAttempt = time.Time{}
+						if keepAliver != nil {
+							// Already online still needs the heartbeat, or the server drops the session.
+							heartbeat = startKeepAlive(ctx, keepAliver)
+						}
+						// Double check internet
+						select {
+						case <-ctx.Done():
+							color.Cyan("守护进程已退出。")
+							return
+						case <-time.After(1 * time.Second): // Wait a sec for NAT/Rule propagation
+						}
+						if s, _, _ := checkState(ctx, monitors); s == drcom.StateOnline {
+							color.Green("[成功] 重新连接成功: %s (且外网可达)", res.Message)
+							drcom.SendWebhook(cfg.Alert.WebhookURL, "网络已重连: "+res.Message)
                          } else {
                              color.Red("[警告] 登录接口返回成功，但外网依然不可达！")
                          }
                     } else {
-                         color.Red("[失败] 登录失败: %s", resp.Msg)
+						color.Red("[失败] 登录失败 [%s]: %s", outcomeText(res.Outcome), res.Message)
+						nextAttempt = time.Now().Add(retryDelay(backoff, res))
+						if res.Outcome.Permanent() {
+							// Retrying would only count towards the portal's lockout limit.
+							pause := &drcom.PauseState{Since: time.Now(), Outcome: res.Outcome, Message: res.Message}
+							if err := drcom.SavePause(cfg.StateDir, pause); err != nil {
+								color.Red("保存暂停状态失败: %v (暂停保留在内存中，重启守护进程前不会自动登录)", err)
+								unsaved = pause
+							}
+							paused, held = true, pause
+							msg := fmt.Sprintf("自动登录已暂停: %s (%s)", outcomeText(res.Outcome), res.Message)
+							color.Red("[%s] %s。修复后运行 'drcom daemon --resume' 恢复。", time.Now().Format("15:04:05"), msg)
+							drcom.SendWebhook(cfg.Alert.WebhookURL, msg)
+						}
                     }
                 }
             }
-            
+
             // Periodic Status Update (Log every 10 mins or so, Alert on Threshold)
             // We verify status even if online to update logs/monitor flow
             if time.Since(lastStatusLogTime) > 10*time.Minute || (!isOnline) {
-                res, err := client.GetStatus()
-                if err == nil {
-                    var flowMB float64
-                    if len(res.Data) > 0 {
-                        flowMB = res.Data[0].UserFlow
-                    } else if res.UserInfo.UserFlow != "" {
-                         // parsing logic fallback...
-                    }
-                    
-                    flowGB := flowMB / 1024
-                    if isOnline {
-                        fmt.Printf("[%s] 状态正常 | 流量: %.2f GB | 余额: %.2f\n", 
-                            time.Now().Format("15:04"), flowGB, res.Data[0].UserMoney)
+				st, err := driver.Status(ctx)
+				if err == nil {
+					flowGB := st.Used.GB(unit)
+					if isOnline {
+						fmt.Printf("[%s] 状态正常 | 流量: %s | 余额: %.2f\n",
+							time.Now().Format("15:04"), st.Used.Format(unit), st.Balance)
                     }
                     lastStatusLogTime = time.Now()
 
@@ -95,11 +221,162 @@ var daemonCmd = &cobra.Command{
                 }
             }
 
-			time.Sleep(interval)
+			select {
+			case <-ctx.Done():
+				color.Cyan("守护进程已退出。")
+				return
+			case err := <-heartbeat.Err():
+				heartbeat = nil
+				if errors.Is(err, drcom.ErrNoSession) {
+					// The server reported the account online elsewhere; there is no session to keep.
+					color.Yellow("[%s] 账号已在其他位置在线，本机无心跳会话。", time.Now().Format("15:04:05"))
+					break
+				}
+				needLogin = true
+				msg := fmt.Sprintf("心跳中断: %v", err)
+				color.Red("[%s] %s，正在重新登录...", time.Now().Format("15:04:05"), msg)
+				drcom.SendWebhook(cfg.Alert.WebhookURL, msg)
+			case batch, ok := <-events:
+				if !ok {
+					events = nil
+					color.Yellow("网络变化事件监听已停止，改为定时检测。")
+					break
+				}
+				color.Cyan("[%s] 检测到网络变化 (%s)，立即检测...", time.Now().Format("15:04:05"), eventsText(batch))
+				if linkChanged(batch, tracker) {
+					for _, fm := range monitors {
+						fm.monitor.Reset()
+					}
+					backoff.Reset()
+					nextAttempt = time.Time{}
+				}
+			case <-time.After(nextWait(interval, nextAttempt)):
+			}
 		}
 	},
 }
 
+// keepAlive is a driver heartbeat running in the background.
+type keepAlive struct {
+	err  chan error
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// startKeepAlive runs the driver heartbeat in the background until the
+// session is lost or Stop is called.
+func startKeepAlive(ctx context.Context, ka drcom.KeepAliver) *keepAlive {
+	ctx, cancel := context.WithCancel(ctx)
+	k := &keepAlive{err: make(chan error, 1), stop: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(k.done)
+		k.err <- ka.KeepAlive(ctx)
+	}()
+	return k
+}
+
+// Err yields the error once the heartbeat has ended; a nil heartbeat's
+// channel is never ready.
+func (k *keepAlive) Err() <-chan error {
+	if k == nil {
+		return nil
+	}
+	return k.err
+}
+
+// Stop cancels the heartbeat and waits for it to return. It is a no-op on
+// a nil heartbeat.
+func (k *keepAlive) Stop() {
+	if k == nil {
+		return
+	}
+	k.stop()
+	<-k.done
+}
+
+// handoverAddress moves the portal session to a new local address and
+// records the change in <state_dir>/events.jsonl.
+func handoverAddress(ctx context.Context, cfg *config.Config, w drcom.AddressWatcher, ch *drcom.AddressChange) {
+	msg := "IP 地址变化: " + addressChangeText(ch)
+	color.Yellow("[%s] %s，正在切换会话...", time.Now().Format("15:04:05"), msg)
+	if err := w.Handover(ctx, ch); err != nil {
+		color.Yellow("  注销旧地址会话失败: %s", requestErrText(err))
+	}
+	if err := drcom.RecordEvent(cfg.StateDir, ch); err != nil {
+		color.Red("  记录事件失败: %v", err)
+	}
+	drcom.SendWebhook(cfg.Alert.WebhookURL, msg)
+}
+
+// addressChangeText formats e.g. "10.1.2.3 -> 10.1.2.99 (eth0)".
+func addressChangeText(ch *drcom.AddressChange) string {
+	var parts []string
+	if ch.NewIP != "" {
+		parts = append(parts, ch.OldIP+" -> "+ch.NewIP)
+	}
+	if ch.NewIPv6 != "" {
+		parts = append(parts, ch.OldIPv6+" -> "+ch.NewIPv6)
+	}
+	s := strings.Join(parts, ", ")
+	if ch.Interface != "" {
+		s += " (" + ch.Interface + ")"
+	}
+	return s
+}
+
+// loginBackoff builds the retry schedule from daemon.backoff_*; the base
+// defaults to the check interval.
+func loginBackoff(cfg *config.Config, interval time.Duration) *drcom.Backoff {
+	b := &drcom.Backoff{
+		Base:   time.Duration(cfg.Daemon.BackoffBase) * time.Second,
+		Max:    time.Duration(cfg.Daemon.BackoffMax) * time.Second,
+		Jitter: cfg.Daemon.BackoffJitter,
+	}
+	if b.Base <= 0 {
+		b.Base = interval
+	}
+	return b
+}
+
+// retryDelay is the backoff delay, stretched to the wait time a
+// rate-limited portal asks for.
+func retryDelay(b *drcom.Backoff, res *drcom.LoginResult) time.Duration {
+	d := b.Next()
+	if res.Outcome == drcom.OutcomeRateLimited {
+		if wait, ok := drcom.RetryAfter(res.Message); ok && wait > d {
+			d = wait
+		}
+	}
+	return d
+}
+
+// nextWait sleeps until the next check, or earlier if a login retry is due.
+func nextWait(interval time.Duration, nextAttempt time.Time) time.Duration {
+	if until := time.Until(nextAttempt); until > 0 && until < interval {
+		return until
+	}
+	return interval
+}
+
+// reloadDriver re-reads the config file and rebuilds the driver.
+func reloadDriver() (*config.Config, drcom.PortalDriver, error) {
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, nil, err
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	driver, err := newDriver(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, driver, nil
+}
+
+var flagResume bool
+
 func init() {
+	daemonCmd.Flags().BoolVar(&flagResume, "resume", false, "清除因密码错误/欠费而暂停的自动登录")
 	rootCmd.AddCommand(daemonCmd)
 }
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,11 +17,13 @@ import (
 )
 
 var (
-	flagUser   string
-	flagPass   string
-	flagHost   string
-	flagSave   bool
-	flagNoSave bool
+	flagUser     string
+	flagPass     string
+	flagHost     string
+	flagIface    string
+	flagDiscover bool
+	flagSave     bool
+	flagNoSave   bool
 )
 
 var loginCmd = &cobra.Command{
@@ -31,13 +36,27 @@ var loginCmd = &cobra.Command{
 			cfg = &config.Config{}
 		}
 
+		if flagIface != "" {
+			cfg.Auth.Interface = flagIface
+		}
+
+		// First run (no config file yet) or explicit request: let the
+		// captive redirect tell us where the portal is.
+		hostDefault := "http://10.10.10.9:801"
+		if flagDiscover || (flagHost == "" && viper.ConfigFileUsed() == "") {
+			if host := discoverPortal(cfg); host != "" {
+				hostDefault = host
+			}
+		}
+
 		if flagHost != "" {
 			cfg.Auth.Host = flagHost
+			cfg.Auth.Hosts = nil
 		}
 		if cfg.Auth.Host == "" {
 			prompt := promptui.Prompt{
 				Label:   "登录地址 (Host)",
-				Default: "http://10.10.10.9:801",
+				Default: hostDefault,
 			}
 			res, err := prompt.Run()
 			if err != nil {
@@ -100,51 +119,92 @@ var loginCmd = &cobra.Command{
 		}
 
 		if shouldSave {
-			home, _ := os.UserHomeDir()
-			configPath := home + "/.config/drcom-go/config.yaml"
-			if viper.ConfigFileUsed() == "" {
-				err := viper.WriteConfigAs(configPath)
-				if err == nil {
-					os.Chmod(configPath, 0600)
-					fmt.Println("配置已保存至:", configPath)
-				} else {
-					fmt.Printf("保存配置失败: %v\n", err)
-				}
+			if path, err := writeConfig(); err != nil {
+				fmt.Printf("保存配置失败: %v\n", err)
 			} else {
-				viper.SafeWriteConfig()
+				fmt.Println("配置已保存至:", path)
 			}
 		}
 
-		client := drcom.NewClient(cfg.Auth.Host, cfg.Auth.Username, cfg.Auth.Password)
+		driver, err := newDriver(cfg)
+		if err != nil {
+			fmt.Printf("初始化认证驱动失败: %v\n", err)
+			return
+		}
 		fmt.Println("正在登录...")
-		resp, err := client.Login()
+		res, err := driver.Login(context.Background())
 		if err != nil {
-			fmt.Printf("登录请求失败: %v\n", err)
+			fmt.Printf("登录请求失败: %s\n", requestErrText(err))
 			return
 		}
 
-		if resp.Result == "1" || resp.Result == 1 || fmt.Sprintf("%v", resp.Result) == "1" {
-			fmt.Printf("\033[32m登录接口成功: %s\033[0m\n", resp.Msg)
-			verifyInternet()
-		} else {
-			// Check "Already online" case loosely
-			if strings.Contains(resp.Msg, "已经在线") {
-				fmt.Printf("\033[33m提示: %s\033[0m\n", resp.Msg)
-				verifyInternet()
-			} else {
-				fmt.Printf("\033[31m登录失败: %s (返回码: %v)\033[0m\n", resp.Msg, resp.Result)
-			}
+		switch res.Outcome {
+		case drcom.OutcomeSuccess:
+			fmt.Printf("\033[32m登录接口成功: %s\033[0m\n", res.Message)
+			verifyInternet(cfg, driver)
+		case drcom.OutcomeAlreadyOnline:
+			fmt.Printf("\033[33m提示: %s\033[0m\n", res.Message)
+			verifyInternet(cfg, driver)
+		default:
+			fmt.Printf("\033[31m登录失败 [%s]: %s (返回码: %v)\033[0m\n", outcomeText(res.Outcome), res.Message, res.Code)
 		}
 	},
 }
 
-func verifyInternet() {
+// discoverPortal follows the captive redirect and, if the user agrees,
+// applies what it finds to cfg and the settings to be saved; the user IP
+// from the redirect is used for this run only. A declined host is
+// returned so it can be offered as the default.
+func discoverPortal(cfg *config.Config) string {
+	fmt.Print("正在探测认证页面...")
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	info, err := drcom.DiscoverPortal(ctx, cfg.Auth.ProbeURL, clientOptions(cfg)...)
+	if err != nil {
+		fmt.Printf(" 未发现 (%v)\n", err)
+		return ""
+	}
+	fmt.Println(" 完成")
+	fmt.Printf("  认证地址: %s\n", info.Host)
+	ac := info.ACParams()
+	keys := make([]string, 0, len(ac))
+	for k := range ac {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("  %s: %s\n", k, ac[k])
+	}
+
+	prompt := promptui.Prompt{
+		Label:     "使用并保存发现的认证地址和 AC 参数",
+		IsConfirm: true,
+	}
+	if _, err := prompt.Run(); err != nil {
+		return info.Host
+	}
+	cfg.Auth.Host = info.Host
+	cfg.Auth.Hosts = nil
+	cfg.Auth.ACParams = ac
+	if ip := info.Params["wlan_user_ip"]; ip != "" && cfg.Auth.IP == "" {
+		cfg.Auth.IP = ip
+	}
+	viper.Set("auth.ac_params", ac)
+	return ""
+}
+
+func verifyInternet(cfg *config.Config, driver drcom.PortalDriver) {
 	fmt.Print("正在验证外网连接...")
 	time.Sleep(1 * time.Second)
-	if drcom.CheckInternet() {
-		fmt.Println("\033[32m [通过] (可以访问百度)\033[0m")
-	} else {
-		fmt.Println("\033[31m [失败] (无法访问百度，请检查网络设置或欠费状态)\033[0m")
+	monitors := newMonitors(cfg, driver)
+	state, down, _ := checkState(context.Background(), monitors)
+	switch {
+	case state == drcom.StateOnline:
+		fmt.Println("\033[32m [通过]\033[0m")
+	case len(down) < len(monitors):
+		fmt.Printf("\033[33m [部分通过] (%s)\033[0m\n", joinDown(down))
+	default:
+		fmt.Printf("\033[31m [失败] (%s，请检查网络设置或欠费状态)\033[0m\n", joinDown(down))
 	}
 }
 
@@ -153,6 +213,25 @@ func init() {
 	loginCmd.Flags().StringVarP(&flagUser, "user", "u", "", "校园网账号")
 	loginCmd.Flags().StringVarP(&flagPass, "pass", "p", "", "校园网密码")
 	loginCmd.Flags().StringVar(&flagHost, "host", "", "认证服务器地址 (例如 http://10.10.10.9:801)")
+	loginCmd.Flags().StringVar(&flagIface, "interface", "", "指定认证使用的网卡 (例如 eth1)")
+	loginCmd.Flags().BoolVar(&flagDiscover, "discover", false, "通过认证重定向自动探测认证地址和 AC 参数")
 	loginCmd.Flags().BoolVar(&flagSave, "save", false, "强制保存配置到本地")
 	loginCmd.Flags().BoolVar(&flagNoSave, "no-save", false, "不保存配置到本地")
-}
\ No newline at end of file
+}
+
+// writeConfig saves the viper settings to the loaded config file, or to a
+// new one that only the user can read, as LoadConfig requires.
+func writeConfig() (string, error) {
+	if file := viper.ConfigFileUsed(); file != "" {
+		return file, viper.WriteConfig()
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(home, ".config", "drcom-go", "config.yaml")
+	if err := viper.WriteConfigAs(path); err != nil {
+		return path, err
+	}
+	return path, os.Chmod(path, 0600)
+}
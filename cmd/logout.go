@@ -1,10 +1,10 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"drcom-go/pkg/config"
-	"drcom-go/pkg/drcom"
 	"github.com/spf13/cobra"
 )
 
@@ -18,16 +18,20 @@ var logoutCmd = &cobra.Command{
 			return
 		}
 
-		client := drcom.NewClient(cfg.Auth.Host, cfg.Auth.Username, cfg.Auth.Password)
-		err = client.Logout()
+		driver, err := newDriver(cfg)
 		if err != nil {
-			fmt.Printf("注销失败: %v\n", err)
+			fmt.Printf("初始化认证驱动失败: %v\n", err)
 			return
 		}
-        fmt.Println("注销请求已发送。")
+		err = driver.Logout(context.Background())
+		if err != nil {
+			fmt.Printf("注销失败: %s\n", requestErrText(err))
+			return
+		}
+		fmt.Println("注销请求已发送。")
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(logoutCmd)
-}
\ No newline at end of file
+}
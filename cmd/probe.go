@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"drcom-go/pkg/config"
+	"drcom-go/pkg/drcom"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	flagProbeSave bool
+	flagProbeHost string
+)
+
+var probePortalCmd = &cobra.Command{
+	Use:   "probe-portal",
+	Short: "识别认证页面类型、版本与密码加密方式",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Printf("警告: 加载配置文件失败: %v\n", err)
+			cfg = &config.Config{}
+		}
+		if flagProbeHost != "" {
+			cfg.Auth.Host = flagProbeHost
+			cfg.Auth.Hosts = nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		fp, err := drcom.FingerprintPortal(ctx, primaryHost(cfg), clientOptions(cfg)...)
+		if fp == nil {
+			color.Red("❌ 访问认证页面失败: %v", err)
+			return
+		}
+		for _, s := range fp.Scripts {
+			fmt.Printf("  已分析脚本: %s\n", s)
+		}
+		if err != nil {
+			color.Yellow("⚠️ %v", err)
+			return
+		}
+
+		p := fp.Profile
+		fmt.Println(color.CyanString("\n🔍 识别结果"))
+		fmt.Printf("驱动:     %s\n", fp.Driver)
+		fmt.Printf("jsVersion: %s\n", valueOr(fp.Version, "未知"))
+		fmt.Printf("密码加密: %s\n", fp.Encryption)
+		if fp.RSAModulus != "" {
+			fmt.Printf("RSA 模数: %s (指数 %s)\n", fp.RSAModulus, fp.RSAExponent)
+		}
+		if fp.PublicKey != "" {
+			fmt.Printf("RSA 公钥: %s\n", fp.PublicKey)
+		}
+
+		fmt.Println(color.CyanString("\n建议配置:"))
+		fmt.Printf("auth:\n  driver: %s\n", fp.Driver)
+		if fp.Driver == drcom.DriverEPortal {
+			fmt.Printf("portal:\n  js_version: %q\n  login_method: %q\n  terminal_type: %q\n  account_template: %q\n  encryption: %s\n",
+				p.JSVersion, p.LoginMethod, p.TerminalType, p.AccountTemplate, p.Encryption)
+			if p.RSAModulus != "" {
+				fmt.Printf("  rsa_modulus: %q\n  rsa_exponent: %q\n", p.RSAModulus, p.RSAExponent)
+			}
+			if p.PublicKey != "" {
+				fmt.Printf("  public_key: %q\n", p.PublicKey)
+			}
+		}
+
+		if !flagProbeSave {
+			return
+		}
+		if flagProbeHost != "" {
+			viper.Set("auth.host", flagProbeHost)
+		}
+		viper.Set("auth.driver", fp.Driver)
+		if fp.Driver == drcom.DriverEPortal {
+			viper.Set("portal.js_version", p.JSVersion)
+			viper.Set("portal.login_method", p.LoginMethod)
+			viper.Set("portal.terminal_type", p.TerminalType)
+			viper.Set("portal.account_template", p.AccountTemplate)
+			viper.Set("portal.encryption", p.Encryption)
+			viper.Set("portal.rsa_modulus", p.RSAModulus)
+			viper.Set("portal.rsa_exponent", p.RSAExponent)
+			viper.Set("portal.public_key", p.PublicKey)
+		}
+		path, err := writeConfig()
+		if err != nil {
+			color.Red("❌ 保存配置失败: %v", err)
+			return
+		}
+		color.Green("✅ 已保存到配置文件 %s", path)
+	},
+}
+
+func valueOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(probePortalCmd)
+	probePortalCmd.Flags().StringVar(&flagProbeHost, "host", "", "认证服务器地址 (默认使用配置)")
+	probePortalCmd.Flags().BoolVar(&flagProbeSave, "save", false, "将识别结果写入配置文件")
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"drcom-go/pkg/config"
+	"drcom-go/pkg/drcom"
+	"github.com/fatih/color"
+)
+
+// familyMonitor probes one address family.
+type familyMonitor struct {
+	family  string
+	monitor *drcom.Monitor
+}
+
+// newMonitors builds a monitor per family in auth.ip_mode. The portal
+// is_login probe is attached to the first one only.
+func newMonitors(cfg *config.Config, driver drcom.PortalDriver) []familyMonitor {
+	p := cfg.Probes
+	mode := ipMode(cfg)
+	k := checker(cfg)
+	var out []familyMonitor
+	if mode.V4() {
+		network := "tcp"
+		if mode == drcom.DualStack {
+			network = "tcp4"
+		}
+		pc := drcom.ProbeConfig{
+			HTTP:          orDefault(p.HTTP, drcom.DefaultHTTPProbes),
+			DNS:           orDefault(p.DNS, drcom.DefaultDNSProbes),
+			TCP:           orDefault(p.TCP, drcom.DefaultTCPProbes),
+			Network:       network,
+			Interface:     k.Interface,
+			TLS:           k.TLS,
+			Quorum:        p.Quorum,
+			FailThreshold: p.FailThreshold,
+		}
+		if p.Portal && driver != nil {
+			pc.Portal = driver
+		}
+		out = append(out, familyMonitor{"IPv4", drcom.NewMonitor(pc)})
+	}
+	if mode.V6() {
+		pc := drcom.ProbeConfig{
+			HTTP:          p.HTTPV6,
+			TCP:           orDefault(p.TCPV6, drcom.DefaultTCPProbesV6),
+			Network:       "tcp6",
+			Interface:     k.Interface,
+			TLS:           k.TLS,
+			Quorum:        p.Quorum,
+			FailThreshold: p.FailThreshold,
+		}
+		if p.Portal && driver != nil && len(out) == 0 {
+			pc.Portal = driver
+		}
+		out = append(out, familyMonitor{"IPv6", drcom.NewMonitor(pc)})
+	}
+	return out
+}
+
+// checkState runs every family's probes. The result is the first
+// non-online state, down lists the affected families and all holds every
+// probe result for diagnose.
+func checkState(ctx context.Context, monitors []familyMonitor) (state drcom.NetState, down []string, all []drcom.ProbeResult) {
+	state = drcom.StateOnline
+	for _, fm := range monitors {
+		s, results := fm.monitor.Check(ctx)
+		all = append(all, results...)
+		if s == drcom.StateOnline {
+			continue
+		}
+		if state == drcom.StateOnline {
+			state = s
+		}
+		down = append(down, fmt.Sprintf("%s %s", fm.family, stateText(s)))
+		if flagDebug {
+			for _, r := range results {
+				fmt.Printf("  [%s] %s ok=%v captive=%v err=%v\n", fm.family, r.Name, r.OK, r.Captive, r.Err)
+			}
+		}
+	}
+	return state, down, all
+}
+
+// stateText describes a connectivity state for terminal output.
+func stateText(s drcom.NetState) string {
+	switch s {
+	case drcom.StateOnline:
+		return "在线"
+	case drcom.StateCaptivePortal:
+		return "需要认证"
+	case drcom.StatePortalUnreachable:
+		return "认证服务器不可达"
+	case drcom.StateNoLink:
+		return "链路断开"
+	case drcom.StateDNSBroken:
+		return "DNS 解析失败"
+	case drcom.StateUpstreamDown:
+		return "已认证但外网不通"
+	default:
+		return "未知"
+	}
+}
+
+func orDefault(v, def []string) []string {
+	if len(v) > 0 {
+		return v
+	}
+	return def
+}
+
+// joinDown formats the families that are down.
+func joinDown(down []string) string {
+	return strings.Join(down, ", ")
+}
+
+// diagnose classifies an outage reported by the probes, reusing their
+// portal result.
+func diagnose(ctx context.Context, cfg *config.Config, driver drcom.PortalDriver, state drcom.NetState, results []drcom.ProbeResult) *drcom.Diagnosis {
+	return drcom.Diagnose(ctx, drcom.DiagnoseConfig{
+		Host:      primaryHost(cfg),
+		Interface: cfg.Auth.Interface,
+		Driver:    driver,
+		State:     state,
+		Results:   results,
+	})
+}
+
+// causeText describes a diagnosed outage cause for terminal output.
+func causeText(d *drcom.Diagnosis) string {
+	var s string
+	switch d.Cause {
+	case drcom.CauseNone:
+		return "无故障"
+	case drcom.CauseNoCarrier:
+		s = "网线未连接或无线未关联"
+	case drcom.CauseNoAddress:
+		s = "未获取到 IP 地址 (DHCP 失败?)"
+	case drcom.CauseGatewayDown:
+		s = fmt.Sprintf("网关 %s 无响应", d.Gateway)
+	case drcom.CausePortalDown:
+		s = "认证服务器不可达"
+	case drcom.CauseLoggedOut:
+		s = "未认证"
+	case drcom.CauseDNS:
+		s = "DNS 解析失败"
+	case drcom.CauseUpstreamDown:
+		s = "已认证，但校园网出口故障"
+	default:
+		s = "原因未知"
+	}
+	if d.Interface != "" {
+		s += " [" + d.Interface + "]"
+	}
+	return s
+}
+
+// netEvents subscribes to kernel network change events when daemon.events
+// is on. A nil channel (never ready) means polling only.
+func netEvents(ctx context.Context, cfg *config.Config, src drcom.EventSource) <-chan []drcom.NetEvent {
+	if !cfg.Daemon.Events {
+		return nil
+	}
+	ch, err := src.Events(ctx)
+	if err != nil {
+		if flagDebug || !errors.Is(err, drcom.ErrEventsUnsupported) {
+			color.Yellow("无法监听网络变化事件 (%v)，仅使用定时检测。", err)
+		}
+		return nil
+	}
+	return drcom.Debounce(drcom.FilterEvents(ch, cfg.Auth.Interface), 500*time.Millisecond, 3*time.Second)
+}
+
+// eventsText summarises a batch of network events, e.g. "eth0 link, route".
+func eventsText(batch []drcom.NetEvent) string {
+	seen := map[string]bool{}
+	var parts []string
+	for _, ev := range batch {
+		s := ev.Kind.String()
+		if ev.Interface != "" {
+			s = ev.Interface + " " + s
+		}
+		if !seen[s] {
+			seen[s] = true
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// linkChanged reports whether a batch brought a link up or down or changed
+// a stable address, after which stale hysteresis and backoff should not
+// delay a new login. Routes and repeated notifications do not count.
+func linkChanged(batch []drcom.NetEvent, t *drcom.ChangeTracker) bool {
+	changed := false
+	for _, ev := range batch {
+		// Every event updates the tracker, so no short-circuit.
+		if t.Changed(ev) {
+			changed = true
+		}
+	}
+	return changed
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var flagDebug bool
+
 var rootCmd = &cobra.Command{
 	Use:   "drcom",
 	Short: "Dr.COM Client for Linux/Headless",
@@ -23,4 +25,5 @@ func Execute() {
 
 func init() {
 	cobra.OnInitialize(config.InitConfig)
+	rootCmd.PersistentFlags().BoolVar(&flagDebug, "debug", false, "输出认证请求调试日志")
 }
@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"strconv"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
 	"drcom-go/pkg/config"
 	"drcom-go/pkg/drcom"
@@ -18,6 +24,11 @@ var (
 	serverPort string
 	configLock sync.Mutex
     globalCfg  *config.Config
+	apiDriver  drcom.PortalDriver
+	// Heartbeat of a UDP session started through /api/login; it runs
+	// under serverCtx, not the request context
+	apiHeartbeat *keepAlive
+	serverCtx    context.Context
 )
 
 var serverCmd = &cobra.Command{
@@ -50,7 +61,8 @@ func runServer(cmd *cobra.Command, args []string) {
 	http.HandleFunc("/api/status", handleStatus)
 	http.HandleFunc("/api/login", handleLogin)
 	http.HandleFunc("/api/logout", handleLogout)
-    
+	http.HandleFunc("/api/resume", handleResume)
+
     // Simple Dashboard
     http.HandleFunc("/", handleDashboard)
 
@@ -59,15 +71,66 @@ func runServer(cmd *cobra.Command, args []string) {
     color.Cyan("   ➜ Dashboard: http://localhost:%s/", port)
     color.Cyan("   ➜ API:       http://localhost:%s/api/status", port)
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serverCtx = ctx
+
+	srv := &http.Server{
+		Addr:        ":" + port,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		color.Red("启动失败: %v", err)
 	}
 }
 
-func getClient() *drcom.DrComClient {
+// getDriver returns the shared portal driver, rebuilding it after the
+// credentials were changed through /api/login.
+func getDriver() (drcom.PortalDriver, error) {
     configLock.Lock()
     defer configLock.Unlock()
-    return drcom.NewClient(globalCfg.Auth.Host, globalCfg.Auth.Username, globalCfg.Auth.Password)
+	if apiDriver == nil {
+		d, err := newDriver(globalCfg)
+		if err != nil {
+			return nil, err
+		}
+		apiDriver = d
+	}
+	return apiDriver, nil
+}
+
+// startHeartbeat keeps a session of a driver with a client-side heartbeat
+// alive after the request; HTTP drivers need none.
+func startHeartbeat(driver drcom.PortalDriver) {
+	ka, ok := driver.(drcom.KeepAliver)
+	if !ok {
+		return
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	apiHeartbeat.Stop()
+	k := startKeepAlive(serverCtx, ka)
+	apiHeartbeat = k
+	go func() {
+		if err := <-k.Err(); !errors.Is(err, context.Canceled) {
+			color.Red("[%s] 心跳中断: %v", time.Now().Format("15:04:05"), err)
+		}
+	}()
+}
+
+// stopHeartbeat stops the heartbeat started by /api/login, if any.
+func stopHeartbeat() {
+	configLock.Lock()
+	defer configLock.Unlock()
+	apiHeartbeat.Stop()
+	apiHeartbeat = nil
 }
 
 func checkToken(r *http.Request) bool {
@@ -88,36 +151,37 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-	client := getClient()
-	res, err := client.GetStatus()
-    
     w.Header().Set("Content-Type", "application/json")
     w.Header().Set("Access-Control-Allow-Origin", "*")
 
+	driver, err := getDriver()
 	if err != nil {
 		json.NewEncoder(w).Encode(drcom.ApiResponse{Code: 500, Msg: err.Error()})
 		return
 	}
+	st, err := driver.Status(r.Context())
+	if err != nil && !errors.Is(err, drcom.ErrNoStatusData) {
+		json.NewEncoder(w).Encode(drcom.ApiResponse{Code: 500, Msg: err.Error()})
+		return
+	}
 
+	unit := drcom.ParseByteUnit(globalCfg.Alert.UnitBase)
 	data := drcom.ApiStatusData{
-        Success: true, // If we got status, we are likely fine
-        IP: client.GetLocalIP(),
-    }
-    
-    // Parse Logic reused from status command
-    if len(res.Data) > 0 {
-        data.FlowGB = res.Data[0].UserFlow / 1024
-        data.Fee = res.Data[0].UserMoney
-        data.Username = globalCfg.Auth.Username // or res.UserAccount if available
-    } else if res.UserInfo.UserFlow != "" {
-        flowKB, _ := strconv.ParseFloat(res.UserInfo.UserFlow, 64)
-        data.FlowGB = flowKB / (1024 * 1024)
-        data.Fee, _ = strconv.ParseFloat(res.UserInfo.UserBalance, 64)
-        data.Username = res.UserInfo.UserName
-    } else {
-        data.Success = false
-        data.Message = "Empty data received"
-    }
+		Success:       st.LoggedIn,
+		Username:      st.Username,
+		FlowGB:        st.Used.GB(unit),
+		UsedBytes:     int64(st.Used),
+		Fee:           st.Balance,
+		OnlineSeconds: st.OnlineSeconds,
+		IP:            st.IP,
+		IPv6:          st.IPv6,
+		Interface:     st.Interface,
+		Host:          st.Host,
+	}
+	if !st.LoggedIn {
+		data.Message = "Empty data received"
+	}
+	data.Paused, _ = drcom.LoadPause(globalCfg.StateDir)
 
 	json.NewEncoder(w).Encode(drcom.ApiResponse{Code: 200, Msg: "success", Data: data})
 }
@@ -142,6 +206,9 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
     if req.Username != "" && req.Password != "" {
         globalCfg.Auth.Username = req.Username
         globalCfg.Auth.Password = req.Password
+		apiDriver = nil
+		apiHeartbeat.Stop()
+		apiHeartbeat = nil
         // Save to runtime viper so it persists? Or just runtime?
         // Let's update viper too
         viper.Set("auth.username", req.Username)
@@ -150,25 +217,37 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
     }
     configLock.Unlock()
 
-    client := getClient()
-    resp, err := client.Login()
-    
     w.Header().Set("Content-Type", "application/json")
     w.Header().Set("Access-Control-Allow-Origin", "*")
 
     apiResp := drcom.ApiResponse{Code: 200, Msg: "Login executed"}
-    
+
+	driver, err := getDriver()
+	var res *drcom.LoginResult
+	if err == nil {
+		// A new login replaces the session the old heartbeat kept.
+		stopHeartbeat()
+		res, err = driver.Login(r.Context())
+	}
     if err != nil {
         apiResp.Code = 500
         apiResp.Msg = err.Error()
     } else {
-        apiResp.Data = resp
-        if resp.Result == "1" || resp.Result == 1 || fmt.Sprintf("%v", resp.Result) == "1" {
-             apiResp.Msg = "Login Success: " + resp.Msg
-        } else {
-             // Handle "Already online" as non-error technically?
-             apiResp.Msg = "Login Result: " + resp.Msg
-        }
+		apiResp.Data = drcom.ApiLoginData{Outcome: res.Outcome, Response: res.Raw}
+		if res.Outcome.OK() {
+			startHeartbeat(driver)
+		}
+		switch res.Outcome {
+		case drcom.OutcomeSuccess:
+			apiResp.Msg = "Login Success: " + res.Message
+			// The account works again; let the daemon retry on its own.
+			drcom.ClearPause(globalCfg.StateDir)
+		case drcom.OutcomeAlreadyOnline:
+			apiResp.Msg = "Already Online: " + res.Message
+		default:
+			apiResp.Code = 500
+			apiResp.Msg = fmt.Sprintf("Login Failed (%s): %s", res.Outcome, res.Message)
+		}
     }
     json.NewEncoder(w).Encode(apiResp)
 }
@@ -178,18 +257,21 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
         http.Error(w, "Forbidden", 403)
         return
     }
-    
+
     if r.Method != http.MethodPost {
         http.Error(w, "Method not allowed", 405)
         return
     }
 
-    client := getClient()
-    err := client.Logout()
-    
     w.Header().Set("Content-Type", "application/json")
     w.Header().Set("Access-Control-Allow-Origin", "*")
-    
+
+	driver, err := getDriver()
+	if err == nil {
+		stopHeartbeat()
+		err = driver.Logout(r.Context())
+	}
+
     if err != nil {
         json.NewEncoder(w).Encode(drcom.ApiResponse{Code: 500, Msg: err.Error()})
     } else {
@@ -197,6 +279,29 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
     }
 }
 
+// handleResume lifts the daemon's login pause after a credential or
+// arrears failure.
+func handleResume(w http.ResponseWriter, r *http.Request) {
+	if !checkToken(r) {
+		http.Error(w, "Forbidden", 403)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if err := drcom.ClearPause(globalCfg.StateDir); err != nil {
+		json.NewEncoder(w).Encode(drcom.ApiResponse{Code: 500, Msg: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(drcom.ApiResponse{Code: 200, Msg: "Auto login resumed"})
+}
+
 func handleDashboard(w http.ResponseWriter, r *http.Request) {
     html := `<!DOCTYPE html>
 <html lang="zh">
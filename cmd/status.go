@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	"drcom-go/pkg/config"
 	"drcom-go/pkg/drcom"
@@ -21,30 +23,27 @@ var statusCmd = &cobra.Command{
 			return
 		}
 
-		client := drcom.NewClient(cfg.Auth.Host, cfg.Auth.Username, cfg.Auth.Password)
-		res, err := client.GetStatus()
+		driver, err := newDriver(cfg)
 		if err != nil {
-			color.Red("❌ 获取状态失败: %v", err)
+			color.Red("❌ 初始化认证驱动失败: %v", err)
 			return
 		}
-
-		var flowMB, money float64
-		var userName string = cfg.Auth.Username
-
-		if len(res.Data) > 0 {
-			flowMB = res.Data[0].UserFlow
-			money = res.Data[0].UserMoney
-		} else if res.UserInfo.UserFlow != "" {
-			flowKB, _ := strconv.ParseFloat(res.UserInfo.UserFlow, 64)
-			flowMB = flowKB / 1024
-			money, _ = strconv.ParseFloat(res.UserInfo.UserBalance, 64)
-			userName = res.UserInfo.UserName
-		} else {
+		st, err := driver.Status(context.Background())
+		if errors.Is(err, drcom.ErrNotLocalSession) {
+			color.Yellow("⚠️ %s\n", requestErrText(err))
+			return
+		}
+		if errors.Is(err, drcom.ErrNoStatusData) {
 			color.Yellow("⚠️ 未获取到有效状态信息。请检查登录状态。\n")
 			return
 		}
+		if err != nil {
+			color.Red("❌ 获取状态失败: %s", requestErrText(err))
+			return
+		}
 
-		flowGB := flowMB / 1024
+		unit := drcom.ParseByteUnit(cfg.Alert.UnitBase)
+		flowGB := st.Used.GB(unit)
 		threshold := cfg.Alert.TrafficThreshold
 		if threshold == 0 {
 			threshold = 80.0
@@ -53,10 +52,35 @@ var statusCmd = &cobra.Command{
 		fmt.Println("\n" + color.CyanString("📡 Dr.COM 状态面板"))
 		fmt.Println(strings.Repeat("-", 35))
 
-		fmt.Printf("👤 账号: %s\n", userName)
-		fmt.Printf("💰 余额: %.2f 元\n", money)
-		
-		trafficStr := fmt.Sprintf("%.2f GB", flowGB)
+		fmt.Printf("👤 账号: %s\n", st.Username)
+		fmt.Printf("💰 余额: %.2f 元\n", st.Balance)
+		if st.IP != "" {
+			if st.Interface != "" {
+				fmt.Printf("🌐 地址: %s (网卡 %s)\n", st.IP, st.Interface)
+			} else {
+				fmt.Printf("🌐 地址: %s\n", st.IP)
+			}
+		}
+		if st.IPv6 != "" {
+			fmt.Printf("🌐 IPv6: %s\n", st.IPv6)
+		}
+		if st.Host != "" {
+			fmt.Printf("🖥️ 认证服务器: %s\n", st.Host)
+		}
+		if hr, ok := driver.(drcom.HostReporter); ok {
+			for _, h := range hr.Hosts() {
+				state := color.GreenString("正常")
+				if h.Failures > 0 {
+					state = color.RedString("连续失败 %d 次: %s", h.Failures, h.LastError)
+				}
+				fmt.Printf("   - %s (延迟 %v) %s\n", h.URL, h.Latency.Round(time.Millisecond), state)
+			}
+		}
+		if st.OnlineSeconds > 0 {
+			fmt.Printf("⏱️ 时长: %v\n", time.Duration(st.OnlineSeconds)*time.Second)
+		}
+
+		trafficStr := st.Used.Format(unit)
 		if flowGB > threshold*0.9 {
 			trafficStr = color.RedString(trafficStr + " [危险]")
 		} else if flowGB > threshold*0.7 {
@@ -74,6 +98,10 @@ var statusCmd = &cobra.Command{
 		} else if flowGB > threshold*0.8 {
 			color.Yellow("\n⚠️  提示: 流量接近上限 (阈值: %.2f GB)", threshold)
 		}
+		if pause, _ := drcom.LoadPause(cfg.StateDir); pause != nil {
+			color.Red("\n⏸️  守护进程自动登录已暂停 (%s): %s", outcomeText(pause.Outcome), pause.Message)
+			color.Red("   修复后运行 'drcom daemon --resume' 恢复。")
+		}
 		fmt.Println(strings.Repeat("-", 35))
 	},
 }
@@ -85,9 +113,11 @@ func printProgressBar(current, total float64) {
 		percent = 1
 	}
 	filled := int(float64(width) * percent)
-	if filled < 0 { filled = 0 }
+	if filled < 0 {
+		filled = 0
+	}
 	bar := strings.Repeat("=", filled) + strings.Repeat("-", width-filled)
-	
+
 	fmt.Printf("[%s] %.0f%%\n", bar, (current/total)*100)
 }
 
@@ -10,24 +10,122 @@ import (
 
 type Config struct {
 	Auth   AuthConfig   `mapstructure:"auth"`
+	Portal PortalConfig `mapstructure:"portal"`
 	Daemon DaemonConfig `mapstructure:"daemon"`
 	Alert  AlertConfig  `mapstructure:"alert"`
 	Server ServerConfig `mapstructure:"server"`
+	Probes ProbesConfig `mapstructure:"probes"`
+	// Directory for runtime state such as the cookie jar
+	StateDir string `mapstructure:"state_dir"`
 }
 
 type AuthConfig struct {
+	Driver   string `mapstructure:"driver"` // eportal (default)
 	Host     string `mapstructure:"host"`
+	// Ordered failover list; overrides host when set
+	Hosts    []string `mapstructure:"hosts"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
+	Timeout  int    `mapstructure:"timeout"` // Seconds
+	// Local side overrides; detected from the interface facing the portal when empty
+	Interface string `mapstructure:"interface"`
+	IP        string `mapstructure:"ip"`
+	MAC       string `mapstructure:"mac"`
+	IPv6      string `mapstructure:"ipv6"`
+	IPMode    string `mapstructure:"ip_mode"` // v4 (default), v6 or dual
+	// wlan_ac_* parameters from the captive redirect, see drcom login --discover
+	ACParams map[string]string `mapstructure:"ac_params"`
+	ProbeURL string            `mapstructure:"probe_url"` // Plain-HTTP URL that triggers the redirect
+	// Extra ret_code/msg -> outcome mappings for portals with unusual wording
+	Outcomes []OutcomeRuleConfig `mapstructure:"outcomes"`
+	TLS TLSConfig `mapstructure:"tls"`
+	// Keep portal cookies in <state_dir>/cookies.json across runs
+	PersistCookies bool `mapstructure:"persist_cookies"`
+	// Driver-specific settings, see the driver documentation
+	Settings map[string]string `mapstructure:"settings"`
+}
+
+// TLSConfig covers HTTPS portals with self-signed or campus-CA certificates.
+type TLSConfig struct {
+	CAFile             string   `mapstructure:"ca_file"`
+	PinSHA256          []string `mapstructure:"pin_sha256"` // Server certificate fingerprints
+	InsecureSkipVerify bool     `mapstructure:"insecure_skip_verify"`
+}
+
+type OutcomeRuleConfig struct {
+	RetCode string `mapstructure:"ret_code"`
+	Msg     string `mapstructure:"msg"`
+	Outcome string `mapstructure:"outcome"` // e.g. wrong_password, account_arrears
+}
+
+// PortalConfig tunes the ePortal request shape. Preset picks a built-in
+// profile; every non-empty field below overrides it, and "-" clears it
+// (as a params value or extra entry, "-" drops the parameter).
+type PortalConfig struct {
+	Preset          string            `mapstructure:"preset"`
+	LoginPath       string            `mapstructure:"login_path"`
+	LogoutPath      string            `mapstructure:"logout_path"`
+	StatusPath      string            `mapstructure:"status_path"`
+	AccountTemplate string            `mapstructure:"account_template"` // e.g. ",0,{account}"
+	LogoutTemplate  string            `mapstructure:"logout_account_template"`
+	Params          map[string]string `mapstructure:"params"`           // Renamed parameters, e.g. account: user_account
+	LoginMethod     string            `mapstructure:"login_method"`
+	JSVersion       string            `mapstructure:"js_version"`
+	TerminalType    string            `mapstructure:"terminal_type"`
+	Lang            string            `mapstructure:"lang"`
+	StatusLang      string            `mapstructure:"status_lang"`
+	IsLogin         string            `mapstructure:"is_login"`      // Sent with the status request
+	Extra           map[string]string `mapstructure:"extra"`         // Static params added to login
+	Callback        string            `mapstructure:"callback"`      // random, fixed or none
+	CallbackName    string            `mapstructure:"callback_name"` // Used with callback: fixed
+	PreLogin        []PreLoginConfig  `mapstructure:"pre_login"`     // Pages fetched before login
+	Encryption      string            `mapstructure:"encryption"`    // none, md5, rsa or auto
+	RSAModulus      string            `mapstructure:"rsa_modulus"`   // Hex, from security.js
+	RSAExponent     string            `mapstructure:"rsa_exponent"`  // Hex, default 10001
+	PublicKey       string            `mapstructure:"public_key"`    // PEM or base64 (JSEncrypt)
+	MD5Salt         string            `mapstructure:"md5_salt"`
+}
+
+// PreLoginConfig fetches url before login and extracts tokens that can be
+// used as {name} in portal.extra.
+type PreLoginConfig struct {
+	URL     string            `mapstructure:"url"`
+	Extract []TokenRuleConfig `mapstructure:"extract"`
+}
+
+type TokenRuleConfig struct {
+	Name     string `mapstructure:"name"`
+	Regex    string `mapstructure:"regex"`     // First capture group
+	JSONPath string `mapstructure:"json_path"` // e.g. data.token
+}
+
+// ProbesConfig selects the connectivity probes. Empty lists use the
+// built-in targets.
+type ProbesConfig struct {
+	HTTP          []string `mapstructure:"http"` // generate_204 URLs
+	HTTPV6        []string `mapstructure:"http_v6"`
+	DNS           []string `mapstructure:"dns"`
+	TCP           []string `mapstructure:"tcp"` // host:port, preferably IP literals
+	TCPV6         []string `mapstructure:"tcp_v6"`
+	Portal        bool     `mapstructure:"portal"`         // Ask the portal whether we are logged in
+	Quorum        int      `mapstructure:"quorum"`         // Probes that must succeed
+	FailThreshold int      `mapstructure:"fail_threshold"` // Consecutive failures before reporting offline
 }
 
 type DaemonConfig struct {
 	Interval int `mapstructure:"interval"` // Seconds
+	// Login retry backoff after failures
+	BackoffBase   int     `mapstructure:"backoff_base"`   // Seconds, defaults to interval
+	BackoffMax    int     `mapstructure:"backoff_max"`    // Seconds
+	BackoffJitter float64 `mapstructure:"backoff_jitter"` // Fraction of the delay, 0..1
+	// React to kernel link/address/route events (Linux) instead of only polling
+	Events bool `mapstructure:"events"`
 }
 
 type AlertConfig struct {
 	TrafficThreshold float64 `mapstructure:"traffic_threshold"` // GB
 	WebhookURL       string  `mapstructure:"webhook_url"`
+	UnitBase         int     `mapstructure:"unit_base"` // 1024 (default) or 1000
 }
 
 type ServerConfig struct {
@@ -51,12 +149,24 @@ func InitConfig() {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 
+	viper.SetDefault("auth.driver", "eportal")
 	viper.SetDefault("auth.host", "http://10.10.10.9:801")
+	viper.SetDefault("auth.timeout", 5)
+	viper.SetDefault("auth.ip_mode", "v4")
+	viper.SetDefault("portal.preset", "default")
 	viper.SetDefault("daemon.interval", 60)
+	viper.SetDefault("daemon.backoff_max", 1800)
+	viper.SetDefault("daemon.events", true)
+	viper.SetDefault("daemon.backoff_jitter", 0.2)
+	viper.SetDefault("probes.portal", true)
+	viper.SetDefault("probes.quorum", 1)
+	viper.SetDefault("probes.fail_threshold", 2)
 	viper.SetDefault("alert.traffic_threshold", 80.0)
 	viper.SetDefault("alert.webhook_url", "")
+	viper.SetDefault("alert.unit_base", 1024)
 	viper.SetDefault("server.port", "8080")
 	viper.SetDefault("server.token", "")
+	viper.SetDefault("state_dir", filepath.Join(configDir, "state"))
 
 	viper.AutomaticEnv() 
 
@@ -89,12 +199,15 @@ func LoadConfig() (*Config, error) {
 }
 
 func SaveConfig(cfg *Config) error {
+    viper.Set("auth.driver", cfg.Auth.Driver)
     viper.Set("auth.host", cfg.Auth.Host)
     viper.Set("auth.username", cfg.Auth.Username)
     viper.Set("auth.password", cfg.Auth.Password)
+    viper.Set("auth.timeout", cfg.Auth.Timeout)
     viper.Set("daemon.interval", cfg.Daemon.Interval)
     viper.Set("alert.traffic_threshold", cfg.Alert.TrafficThreshold)
     viper.Set("alert.webhook_url", cfg.Alert.WebhookURL)
+    viper.Set("alert.unit_base", cfg.Alert.UnitBase)
     viper.Set("server.port", cfg.Server.Port)
     viper.Set("server.token", cfg.Server.Token)
     
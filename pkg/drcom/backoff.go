@@ -0,0 +1,141 @@
+package drcom
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// maxBackoff caps the delay when Max is unset, so it never grows out of
+// the range of time.Duration.
+const maxBackoff = 24 * time.Hour
+
+// Backoff computes retry delays that grow exponentially after each
+// failure. Jitter spreads the delays so machines that lost the network
+// together do not retry in lockstep.
+type Backoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Factor float64 // Default 2
+	Jitter float64 // Fraction of the delay, 0..1
+
+	attempts int
+	rand     func() float64
+}
+
+// Next returns the delay before the next attempt and counts a failure.
+func (b *Backoff) Next() time.Duration {
+	factor := b.Factor
+	if factor < 1 {
+		factor = 2
+	}
+	ceiling := float64(maxBackoff)
+	if b.Max > 0 {
+		ceiling = float64(b.Max)
+	}
+	d := float64(b.Base) * math.Pow(factor, float64(b.attempts))
+	if d >= ceiling {
+		d = ceiling
+	} else {
+		b.attempts++
+	}
+	if b.Jitter > 0 {
+		r := rand.Float64
+		if b.rand != nil {
+			r = b.rand
+		}
+		// Uniform in [d*(1-jitter), d*(1+jitter)].
+		d += d * b.Jitter * (2*r() - 1)
+		if d > ceiling {
+			d = ceiling
+		}
+	}
+	return time.Duration(d)
+}
+
+// Reset starts over after a success.
+func (b *Backoff) Reset() {
+	b.attempts = 0
+}
+
+// Attempts returns the number of failures since the last Reset; it stops
+// counting once the delay has reached its ceiling.
+func (b *Backoff) Attempts() int {
+	return b.attempts
+}
+
+// retryAfterRe matches wait hints such as "请5分钟后再试" or
+// "retry after 30 seconds".
+var retryAfterRe = regexp.MustCompile(`(?i)(\d+)\s*(秒|分钟|分|小时|seconds?|secs?|s\b|minutes?|mins?|m\b|hours?|h\b)`)
+
+// RetryAfter extracts the wait time a portal asks for in a rate-limit
+// message.
+func RetryAfter(msg string) (time.Duration, bool) {
+	m := retryAfterRe.FindStringSubmatch(msg)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	unit := time.Second
+	switch u := m[2]; {
+	case u == "分钟" || u == "分" || u[0] == 'm' || u[0] == 'M':
+		unit = time.Minute
+	case u == "小时" || u[0] == 'h' || u[0] == 'H':
+		unit = time.Hour
+	}
+	return time.Duration(n) * unit, true
+}
+
+// PauseState records why automatic logins were stopped. It is kept in a
+// file so the pause survives restarts and can be lifted from another
+// process (drcom daemon --resume or the API server).
+type PauseState struct {
+	Since   time.Time    `json:"since"`
+	Outcome LoginOutcome `json:"outcome"`
+	Message string       `json:"message"`
+}
+
+const pauseFile = "paused.json"
+
+// LoadPause returns the pause recorded in dir, or nil if logins are not
+// paused.
+func LoadPause(dir string) (*PauseState, error) {
+	data, err := os.ReadFile(filepath.Join(dir, pauseFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st PauseState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// SavePause records a pause in dir.
+func SavePause(dir string, st *PauseState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, pauseFile), data)
+}
+
+// ClearPause lifts a pause; it is not an error if there is none.
+func ClearPause(dir string) error {
+	err := os.Remove(filepath.Join(dir, pauseFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
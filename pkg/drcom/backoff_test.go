@@ -0,0 +1,102 @@
+package drcom
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffNext(t *testing.T) {
+	const s = time.Second
+	tests := []struct {
+		name string
+		b    Backoff
+		want []time.Duration
+	}{
+		{"doubles", Backoff{Base: s}, []time.Duration{1 * s, 2 * s, 4 * s, 8 * s}},
+		{"factor", Backoff{Base: s, Factor: 3}, []time.Duration{1 * s, 3 * s, 9 * s}},
+		{"factor below 1 means 2", Backoff{Base: s, Factor: 0.5}, []time.Duration{1 * s, 2 * s}},
+		{"max", Backoff{Base: s, Max: 5 * s}, []time.Duration{1 * s, 2 * s, 4 * s, 5 * s, 5 * s}},
+		{"jitter low", Backoff{Base: 10 * s, Jitter: 0.5, rand: func() float64 { return 0 }}, []time.Duration{5 * s, 10 * s}},
+		{"jitter high", Backoff{Base: 10 * s, Jitter: 0.5, rand: func() float64 { return 1 }}, []time.Duration{15 * s, 30 * s}},
+		{"jitter capped at max", Backoff{Base: 10 * s, Max: 12 * s, Jitter: 0.5, rand: func() float64 { return 1 }}, []time.Duration{12 * s, 12 * s}},
+	}
+	for _, tt := range tests {
+		b := tt.b
+		for i, want := range tt.want {
+			if got := b.Next(); got != want {
+				t.Errorf("%s: delay %d = %v, want %v", tt.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestBackoffCeiling(t *testing.T) {
+	b := Backoff{Base: time.Second}
+	for i := 0; i < 2000; i++ {
+		if d := b.Next(); d <= 0 || d > maxBackoff {
+			t.Fatalf("delay %d = %v", i, d)
+		}
+	}
+	// 2^17 s exceeds a day, so counting stops there.
+	if b.Attempts() != 17 {
+		t.Fatalf("attempts %d, want 17", b.Attempts())
+	}
+
+	b = Backoff{Base: time.Second, Max: 4 * time.Second}
+	for i := 0; i < 10; i++ {
+		b.Next()
+	}
+	if b.Attempts() != 2 {
+		t.Fatalf("attempts %d at Max, want 2", b.Attempts())
+	}
+	b.Reset()
+	if b.Attempts() != 0 || b.Next() != time.Second {
+		t.Fatal("Reset did not start over")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want time.Duration
+		ok   bool
+	}{
+		{"认证过于频繁，请5分钟后再试", 5 * time.Minute, true},
+		{"请 30 秒后重试", 30 * time.Second, true},
+		{"请1小时后再登录", time.Hour, true},
+		{"请2分后再试", 2 * time.Minute, true},
+		{"Too many attempts, retry after 45 seconds", 45 * time.Second, true},
+		{"retry after 10 mins", 10 * time.Minute, true},
+		{"wait 2h", 2 * time.Hour, true},
+		{"wait 90s", 90 * time.Second, true},
+		{"请0秒后再试", 0, false},
+		{"认证过于频繁", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := RetryAfter(tt.msg)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%q: %v %v, want %v %v", tt.msg, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPauseState(t *testing.T) {
+	dir := t.TempDir()
+	if st, err := LoadPause(dir); st != nil || err != nil {
+		t.Fatalf("no pause: %v %v", st, err)
+	}
+	want := &PauseState{Since: time.Unix(1700000000, 0).UTC(), Outcome: OutcomeWrongPassword, Message: "密码错误"}
+	if err := SavePause(dir, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadPause(dir)
+	if err != nil || got == nil || !got.Since.Equal(want.Since) || got.Outcome != want.Outcome || got.Message != want.Message {
+		t.Fatalf("loaded %+v, %v", got, err)
+	}
+	if err := ClearPause(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ClearPause(dir); err != nil {
+		t.Fatalf("clearing twice: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package drcom
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// interfaceDialer returns a dialer whose sockets leave through ifname. On
+// Linux this uses SO_BINDTODEVICE where permitted; otherwise the socket is
+// bound to the interface's address, which most stacks honour for route
+// selection.
+func interfaceDialer(ifname, network string) (*net.Dialer, error) {
+	d := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if ifname == "" {
+		return d, nil
+	}
+	if bindsToDevice(ifname) {
+		d.Control = bindControl(ifname)
+		return d, nil
+	}
+	ip, err := interfaceIP(ifname, strings.HasSuffix(network, "6"))
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(network, "udp") {
+		d.LocalAddr = &net.UDPAddr{IP: ip}
+	} else {
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return d, nil
+}
+
+// bindDialContext is an http.Transport DialContext bound to ifname.
+func bindDialContext(ifname string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		d, err := interfaceDialer(ifname, network)
+		if err != nil {
+			return nil, err
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
@@ -0,0 +1,58 @@
+//go:build linux
+
+package drcom
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"syscall"
+)
+
+// setBindToDevice applies SO_BINDTODEVICE; replaced in tests.
+var setBindToDevice = func(fd int, ifname string) error {
+	return syscall.SetsockoptString(fd, syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, ifname)
+}
+
+var deviceBind struct {
+	once      sync.Once
+	permitted bool
+}
+
+// bindsToDevice reports whether sockets can be pinned to ifname with
+// SO_BINDTODEVICE. Without CAP_NET_RAW the kernel answers EPERM; this is
+// checked once per process and logged, and interfaceDialer falls back to
+// binding the interface address.
+func bindsToDevice(ifname string) bool {
+	deviceBind.once.Do(func() {
+		deviceBind.permitted = true
+		fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return
+		}
+		defer syscall.Close(fd)
+		if err := setBindToDevice(fd, ifname); errors.Is(err, syscall.EPERM) {
+			deviceBind.permitted = false
+			log.Printf("SO_BINDTODEVICE on %s not permitted (needs root or CAP_NET_RAW); binding to its address instead", ifname)
+		}
+	})
+	return deviceBind.permitted
+}
+
+// bindControl pins a socket to ifname with SO_BINDTODEVICE (needs
+// CAP_NET_RAW or root).
+func bindControl(ifname string) func(network, address string, c syscall.RawConn) error {
+	if ifname == "" {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			serr = setBindToDevice(int(fd), ifname)
+		})
+		if err != nil {
+			return err
+		}
+		return serr
+	}
+}
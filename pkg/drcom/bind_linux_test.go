@@ -0,0 +1,63 @@
+//go:build linux
+
+package drcom
+
+import (
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// TestInterfaceDialerFallback checks that without CAP_NET_RAW the dialer
+// binds the interface address instead of failing every connection.
+func TestInterfaceDialerFallback(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	saved := setBindToDevice
+	defer func() {
+		setBindToDevice = saved
+		deviceBind.once = sync.Once{}
+	}()
+	calls := 0
+	setBindToDevice = func(fd int, ifname string) error {
+		calls++
+		return syscall.EPERM
+	}
+	deviceBind.once = sync.Once{}
+
+	for i := 0; i < 2; i++ {
+		d, err := interfaceDialer("lo", "tcp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Control != nil {
+			t.Fatal("SO_BINDTODEVICE used after EPERM")
+		}
+		if a, ok := d.LocalAddr.(*net.TCPAddr); !ok || !a.IP.IsLoopback() {
+			t.Fatalf("local address %v, want the lo address", d.LocalAddr)
+		}
+		conn, err := d.Dial("tcp4", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+	// Checked once per process.
+	if calls != 1 {
+		t.Fatalf("%d SO_BINDTODEVICE attempts, want 1", calls)
+	}
+}
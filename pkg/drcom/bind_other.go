@@ -0,0 +1,16 @@
+//go:build !linux
+
+package drcom
+
+import "syscall"
+
+// bindsToDevice is false outside Linux; sockets are bound to the
+// interface address instead, see interfaceDialer.
+func bindsToDevice(ifname string) bool {
+	return false
+}
+
+// bindControl is a no-op outside Linux.
+func bindControl(ifname string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
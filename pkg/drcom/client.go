@@ -1,67 +1,229 @@
 package drcom
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func NewClient(host, username, password string) *DrComClient {
-	return &DrComClient{
-		Host:     strings.TrimRight(host, "/"),
-		Username: username,
-		Password: password,
+// NewClient creates an ePortal client. All requests made by the returned
+// client share one keep-alive HTTP client.
+func NewClient(host, username, password string, opts ...Option) *DrComClient {
+	c := &DrComClient{
+		Host:       strings.TrimRight(host, "/"),
+		Username:   username,
+		Password:   password,
+		timeout:    defaultTimeout,
+		userAgent:  defaultUserAgent,
+		logger:     nopLogger{},
+		now:        time.Now,
+		classifier: NewClassifier(),
+		profile:    DefaultProfile,
+		ipMode:     IPv4Only,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.pinnedIP, c.pinnedIPv6 = c.IP != "", c.IPv6 != ""
+	if c.jar == nil && len(c.preLogin) > 0 {
+		// Pre-login steps exist to pick up a session cookie.
+		c.jar, _ = cookiejar.New(nil)
+	}
+	transport := c.transport
+	if transport == nil && (c.iface != "" || c.tlsConfig != nil) {
+		transport = newTransport(c.iface, c.tlsConfig)
+	}
+	c.httpClient = &http.Client{
+		Timeout:   c.timeout,
+		Transport: transport,
+		Jar:       c.jar,
+	}
+	return c
+}
+
+// host returns the portal host currently in use; failover may change it.
+func (c *DrComClient) host() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Host
 }
 
-// Auto-detect local IP if not set
+// currentProfile returns a copy of the profile, which encryption detection
+// may update.
+func (c *DrComClient) currentProfile() Profile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.profile
+}
+
+// GetLocalIP returns the configured IP, or the address of the interface
+// facing the portal. The result is cached.
 func (c *DrComClient) GetLocalIP() string {
-	if c.IP != "" {
-		return c.IP
+	c.mu.Lock()
+	ip := c.IP
+	c.mu.Unlock()
+	if ip != "" {
+		return ip
 	}
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
+	la := c.LocalAddr()
+	if la == nil {
 		return ""
 	}
-	defer conn.Close()
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	c.IP = localAddr.IP.String()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.IP == "" {
+		c.IP = la.IP.String()
+	}
 	return c.IP
 }
 
+// GetLocalIPv6 returns the configured IPv6, or a global address of the
+// portal-facing interface. The result is cached; "" if there is none.
+func (c *DrComClient) GetLocalIPv6() string {
+	c.mu.Lock()
+	ip6 := c.IPv6
+	c.mu.Unlock()
+	if ip6 != "" {
+		return ip6
+	}
+	ifname := c.iface
+	if ifname == "" {
+		if la := c.LocalAddr(); la != nil {
+			ifname = la.Interface
+		}
+	}
+	ip, err := detectIPv6(ifname)
+	if err != nil {
+		c.logger.Printf("IPv6 detection failed: %v", err)
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.IPv6 == "" {
+		c.IPv6 = ip.String()
+	}
+	return c.IPv6
+}
+
+// detectIPv6 is DetectLocalIPv6 with a fallback to the default route, as
+// the portal-facing interface may not carry IPv6 itself.
+func detectIPv6(ifname string) (net.IP, error) {
+	ip, err := DetectLocalIPv6(ifname)
+	if err != nil && ifname != "" {
+		ip, err = DetectLocalIPv6("")
+	}
+	return ip, err
+}
+
+// IPMode returns the address families this client authenticates.
+func (c *DrComClient) IPMode() IPMode {
+	return c.ipMode
+}
+
+// setAddrParams fills the address parameters for the configured IP mode.
+// A family that is not authenticated is sent empty, as the portal JS does.
+func (c *DrComClient) setAddrParams(params url.Values) {
+	p := c.currentProfile()
+	ip, ip6 := "", ""
+	if c.ipMode.V4() {
+		ip = c.GetLocalIP()
+	}
+	if c.ipMode.V6() {
+		ip6 = c.GetLocalIPv6()
+	}
+	setParam(params, p.Names.IP, ip)
+	if p.Names.IPv6 != "" {
+		setParam(params, p.Names.IPv6, ip6)
+	}
+}
+
+// LocalAddr returns the detected interface, address and MAC facing the
+// portal, or nil if detection failed.
+func (c *DrComClient) LocalAddr() *LocalAddr {
+	c.mu.Lock()
+	la := c.local
+	c.mu.Unlock()
+	if la != nil {
+		return la
+	}
+	la, err := DetectLocalAddr(c.host(), c.iface)
+	if err != nil {
+		c.logger.Printf("local address detection failed: %v", err)
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.local == nil {
+		c.local = la
+	}
+	return c.local
+}
+
+// localMAC returns the configured MAC, or the detected one, as 12 hex digits.
+func (c *DrComClient) localMAC() string {
+	if c.mac != nil {
+		return formatMAC(c.mac)
+	}
+	if la := c.LocalAddr(); la != nil {
+		return formatMAC(la.MAC)
+	}
+	return formatMAC(nil)
+}
+
 func (c *DrComClient) Login() (*LoginResponse, error) {
-	api := c.Host + "/eportal/portal/login"
-	
+	return c.LoginContext(context.Background())
+}
+
+func (c *DrComClient) LoginContext(ctx context.Context) (*LoginResponse, error) {
+	if err := c.resolveEncryption(ctx); err != nil {
+		return nil, err
+	}
+	tokens, err := c.runPreLogin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p := c.currentProfile()
+	api := c.host() + p.LoginPath
+	password, encrypted, err := p.encodePassword(c.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	// Prepare params
 	params := url.Values{}
-	callback := fmt.Sprintf("dr%d", 1000+rand.Intn(9000))
-	params.Set("callback", callback)
-	params.Set("login_method", "1")
-	// Based on request.md, there is a weird prefix: ,`, (comma backtick comma)
-	// We will try to prepend it if the username doesn't already have it.
-	// Actually, let's just prepend it as per the capture. 
-	// If this varies, we might need a config option.
-	// Decoding %2C%60%2C -> ,`,
-	params.Set("user_account", ",`,"+c.Username) 
-	params.Set("user_password", c.Password)
-	params.Set("wlan_user_ip", c.GetLocalIP())
-	params.Set("wlan_user_mac", "000000000000")
-	params.Set("jsVersion", "4.2.1")
-	params.Set("terminal_type", "1")
-	params.Set("lang", "zh-cn")
+	if cb := p.callback(); cb != "" {
+		setParam(params, p.Names.Callback, cb)
+	}
+	setParam(params, p.Names.LoginMethod, p.LoginMethod)
+	setParam(params, p.Names.Account, p.Account(c.Username))
+	setParam(params, p.Names.Password, password)
+	if encrypted && p.Names.Encrypt != "" {
+		setParam(params, p.Names.Encrypt, "1")
+	}
+	c.setAddrParams(params)
+	setParam(params, p.Names.MAC, c.localMAC())
+	setParam(params, p.Names.JSVersion, p.JSVersion)
+	setParam(params, p.Names.TerminalType, p.TerminalType)
+	setParam(params, p.Names.Lang, p.Lang)
+	for k, v := range c.acParams {
+		params.Set(k, v)
+	}
+	for k, v := range p.Extra {
+		params.Set(k, expandTokens(v, tokens))
+	}
 	params.Set("v", strconv.Itoa(rand.Intn(9999)))
 
 	reqURL := api + "?" + params.Encode()
-	
-	resp, err := c.doRequest(reqURL)
+
+	resp, err := c.doRequest(ctx, reqURL)
 	if err != nil {
 		return nil, err
 	}
@@ -73,42 +235,59 @@ func (c *DrComClient) Login() (*LoginResponse, error) {
 	return &res, nil
 }
 
+// Classify maps a login response to a typed outcome using the client's rules.
+func (c *DrComClient) Classify(resp *LoginResponse) LoginOutcome {
+	return c.classifier.Classify(resp)
+}
+
 func (c *DrComClient) Logout() error {
-	api := c.Host + "/eportal/portal/logout"
+	return c.LogoutContext(context.Background())
+}
+
+func (c *DrComClient) LogoutContext(ctx context.Context) error {
+	p := c.currentProfile()
+	api := c.host() + p.LogoutPath
 	params := url.Values{}
-	callback := fmt.Sprintf("dr%d", 1000+rand.Intn(9000))
-	params.Set("callback", callback)
-	params.Set("user_account", c.Username) // Logout usually doesn't need the prefix
-	params.Set("wlan_user_ip", c.GetLocalIP())
-	params.Set("jsVersion", "4.2.1")
+	if cb := p.callback(); cb != "" {
+		setParam(params, p.Names.Callback, cb)
+	}
+	setParam(params, p.Names.Account, p.LogoutAccount(c.Username))
+	c.setAddrParams(params)
+	setParam(params, p.Names.JSVersion, p.JSVersion)
 	params.Set("v", strconv.Itoa(rand.Intn(9999)))
-    
-    // Some versions use login_method=1 for logout too? No, usually distinct endpoint.
-    
-    reqURL := api + "?" + params.Encode()
-	resp, err := c.doRequest(reqURL)
+
+	// Some versions use login_method=1 for logout too? No, usually distinct endpoint.
+
+	reqURL := api + "?" + params.Encode()
+	resp, err := c.doRequest(ctx, reqURL)
 	if err != nil {
 		return err
 	}
-    // We just check if it returns valid JSONP, ignoring content usually
-    var res map[string]interface{}
-    return parseJSONP(resp, &res)
+	// We just check if it returns valid JSONP, ignoring content usually
+	var res map[string]interface{}
+	return parseJSONP(resp, &res)
 }
 
 func (c *DrComClient) GetStatus() (*UserInfoResponse, error) {
+	return c.GetStatusContext(context.Background())
+}
+
+func (c *DrComClient) GetStatusContext(ctx context.Context) (*UserInfoResponse, error) {
 	// Using loadUserInfo as it seems richer
-	api := c.Host + "/eportal/portal/custom/loadUserInfo"
+	p := c.currentProfile()
+	api := c.host() + p.StatusPath
 	params := url.Values{}
-	callback := fmt.Sprintf("dr%d", 1000+rand.Intn(9000))
-	params.Set("callback", callback)
-	params.Set("wlan_user_ip", c.GetLocalIP())
-	params.Set("is_login", "0") // request.md has is_login=0, maybe checks if logged in?
-	params.Set("jsVersion", "4.2.1")
+	if cb := p.callback(); cb != "" {
+		setParam(params, p.Names.Callback, cb)
+	}
+	c.setAddrParams(params)
+	setParam(params, p.Names.IsLogin, p.IsLogin)
+	setParam(params, p.Names.JSVersion, p.JSVersion)
 	params.Set("v", strconv.Itoa(rand.Intn(9999)))
-	params.Set("lang", "zh")
+	setParam(params, p.Names.Lang, p.StatusLang)
 
 	reqURL := api + "?" + params.Encode()
-	resp, err := c.doRequest(reqURL)
+	resp, err := c.doRequest(ctx, reqURL)
 	if err != nil {
 		return nil, err
 	}
@@ -120,51 +299,122 @@ func (c *DrComClient) GetStatus() (*UserInfoResponse, error) {
 	return &res, nil
 }
 
-func (c *DrComClient) doRequest(urlStr string) (string, error) {
-	client := &http.Client{
-		Timeout: 5 * time.Second,
+func (c *DrComClient) doRequest(ctx context.Context, urlStr string) (string, error) {
+	return c.send(ctx, "GET", urlStr, nil)
+}
+
+// send performs a portal request with the browser headers; a non-nil form
+// is sent as an urlencoded body. With several hosts configured, requests
+// under Host fail over to the next healthy host on network errors and 5xx
+// answers, and Host follows the host that answered.
+func (c *DrComClient) send(ctx context.Context, method, urlStr string, form url.Values) (string, error) {
+	current := c.host()
+	if c.pool == nil || current == "" || !strings.HasPrefix(urlStr, current) {
+		body, _, err := c.sendTo(ctx, method, urlStr, current, form)
+		return body, err
+	}
+	path := urlStr[len(current):]
+	hosts := c.pool.order(c.now())
+	var (
+		body string
+		err  error
+	)
+	for i, host := range hosts {
+		var status int
+		start := c.now()
+		body, status, err = c.sendTo(ctx, method, host+path, host, form)
+		if err == nil && status >= 500 {
+			err = fmt.Errorf("HTTP %d", status)
+		}
+		c.pool.report(host, c.now(), c.now().Sub(start), err)
+		if err == nil || ctx.Err() != nil {
+			if err == nil && host != current {
+				c.logger.Printf("portal host switched from %s to %s", current, host)
+				c.mu.Lock()
+				c.Host = host
+				c.mu.Unlock()
+			}
+			break
+		}
+		if i == len(hosts)-1 && status >= 500 {
+			// Nothing better left; hand the last answer to the caller.
+			return body, nil
+		}
 	}
-	req, err := http.NewRequest("GET", urlStr, nil)
+	return body, err
+}
+
+// sendTo performs one request; host is only used for the Referer.
+func (c *DrComClient) sendTo(ctx context.Context, method, urlStr, host string, form url.Values) (string, int, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, body)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
-	
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
 	// Headers from request.md
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/143.0.0.0 Safari/537.36")
-	req.Header.Set("Referer", c.Host + "/")
-    
-	resp, err := client.Do(req)
+	req.Header.Set("User-Agent", c.userAgent)
+	referer := c.referer
+	if referer == "" {
+		referer = host + "/"
+	}
+	req.Header.Set("Referer", referer)
+
+	start := c.now()
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", err
+		c.logger.Printf("%s %s failed after %v: %v", method, req.URL.Path, c.now().Sub(start), err)
+		return "", 0, err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", resp.StatusCode, err
+	}
+	c.logger.Printf("%s %s%s -> %d (%v)", method, req.URL.Host, req.URL.Path, resp.StatusCode, c.now().Sub(start))
+	return decodeBody(data, resp.Header.Get("Content-Type")), resp.StatusCode, nil
+}
+
+// Hosts returns the health of every configured portal host, or nil when
+// only a single host is used.
+func (c *DrComClient) Hosts() []HostHealth {
+	if c.pool == nil {
+		return nil
+	}
+	return c.pool.snapshot()
+}
+
+// fetchNoRedirect GETs urlStr without following redirects and returns the
+// redirect target (if any) and the body, for captive-portal detection.
+func (c *DrComClient) fetchNoRedirect(ctx context.Context, urlStr string) (location, body string, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	hc := *c.httpClient
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := hc.Do(req)
 	if err != nil {
-		return "", err
-	}
-	return string(body), nil
-}
-
-func parseJSONP(content string, v interface{}) error {
-	// Match content inside callback(...)
-	re := regexp.MustCompile(`^.*?\((.*)\);?$`)
-	matches := re.FindStringSubmatch(strings.TrimSpace(content))
-	
-	jsonStr := content
-	if len(matches) > 1 {
-		jsonStr = matches[1]
-	}
-    
-    // Debug print
-    // fmt.Println("DEBUG JSON:", jsonStr)
-    
-    // Sometimes JSONP is just callback({ ... }) without ;
-    // Or sometimes failure is just html.
-    
-	if err := json.Unmarshal([]byte(jsonStr), v); err != nil {
-		// Log content for debugging if it fails
-		return fmt.Errorf("failed to parse JSON: %v, content: %s", err, content)
-	}
-	return nil
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", "", err
+	}
+	if loc, err := resp.Location(); err == nil {
+		location = loc.String()
+	}
+	c.logger.Printf("GET %s -> %d (location %q)", urlStr, resp.StatusCode, location)
+	return location, decodeBody(data, resp.Header.Get("Content-Type")), nil
 }
@@ -0,0 +1,87 @@
+package drcom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestClientConcurrent shares one client between goroutines the way the
+// API server does, so address detection, failover and encryption
+// detection all run concurrently. Run with -race.
+func TestClientConcurrent(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cb := r.URL.Query().Get("callback")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<script>var api = "/eportal/portal/login"; pwd = hex_md5(password);</script>`)
+		case "/eportal/portal/login":
+			fmt.Fprintf(w, `%s({"result":1,"msg":"ok"})`, cb)
+		case "/eportal/portal/custom/loadUserInfo":
+			fmt.Fprintf(w, `%s({"code":"1","data":[{"userAccount":"student","userFlow":"1024"}]})`, cb)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer up.Close()
+
+	c := NewClient("", "student", "secret", WithHosts(down.URL, up.URL),
+		WithProfile(DefaultProfile.Merge(Profile{Encryption: EncryptAuto})))
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				if _, err := c.LoginContext(ctx); err != nil {
+					t.Errorf("login: %v", err)
+				}
+				return
+			}
+			if _, err := c.AccountStatus(ctx); err != nil && err != ErrNoStatusData {
+				t.Errorf("status: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if c.host() != up.URL {
+		t.Fatalf("host %s, want the backup %s", c.host(), up.URL)
+	}
+	// Detection fails over like the login itself.
+	if p := c.currentProfile(); p.Encryption != EncryptMD5 {
+		t.Fatalf("encryption %q, want md5", p.Encryption)
+	}
+}
+
+func TestEPortalProbeFailover(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer up.Close()
+
+	d := NewEPortalDriver(NewClient("", "student", "secret", WithHosts(down.URL, up.URL)))
+	for i := 0; i < hostDownAfter; i++ {
+		if err := d.Probe(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hosts := d.Hosts()
+	if hosts[0].Failures != hostDownAfter || hosts[1].LastSuccess.IsZero() {
+		t.Fatalf("host health %+v", hosts)
+	}
+	if d.Client.host() != up.URL {
+		t.Fatalf("host %s, want %s", d.Client.host(), up.URL)
+	}
+}
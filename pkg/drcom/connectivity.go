@@ -0,0 +1,384 @@
+package drcom
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// NetState is the connectivity state derived from the probes.
+type NetState int
+
+const (
+	StateUnknown           NetState = iota
+	StateOnline                     // Internet reachable
+	StateCaptivePortal              // Traffic is intercepted; a login is needed
+	StatePortalUnreachable          // Link is up but the portal does not answer
+	StateNoLink                     // Nothing answers at all
+	StateDNSBroken                  // Addresses are reachable but names do not resolve
+	StateUpstreamDown               // Logged in (or no portal probe) but no internet
+)
+
+var netStateNames = map[NetState]string{
+	StateUnknown:           "unknown",
+	StateOnline:            "online",
+	StateCaptivePortal:     "captive_portal",
+	StatePortalUnreachable: "portal_unreachable",
+	StateNoLink:            "no_link",
+	StateDNSBroken:         "dns_broken",
+	StateUpstreamDown:      "upstream_down",
+}
+
+func (s NetState) String() string {
+	if n, ok := netStateNames[s]; ok {
+		return n
+	}
+	return "unknown"
+}
+
+func (s NetState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// NeedsLogin reports whether logging in may fix the state.
+func (s NetState) NeedsLogin() bool {
+	switch s {
+	case StateCaptivePortal, StateDNSBroken, StateUpstreamDown, StateUnknown:
+		return true
+	}
+	return false
+}
+
+// Default probe targets; generate_204 endpoints answer 204 with no body.
+var (
+	DefaultHTTPProbes  = []string{"http://connect.rom.miui.com/generate_204", "http://wifi.vivo.com.cn/generate_204"}
+	DefaultDNSProbes   = []string{"www.baidu.com", "www.qq.com"}
+	DefaultTCPProbes   = []string{"223.5.5.5:53", "119.29.29.29:53"}
+	DefaultTCPProbesV6 = []string{"[2400:3200::1]:53", "[2402:4e00::]:53"}
+)
+
+// ProbeResult is the outcome of one probe run.
+type ProbeResult struct {
+	Name     string
+	OK       bool
+	Captive  bool // The answer was intercepted (redirect or unexpected content)
+	LoggedIn bool // Portal probes: the portal reports an active session
+	Err      error
+	Latency  time.Duration
+}
+
+// Prober is one connectivity check.
+type Prober interface {
+	Name() string
+	Run(ctx context.Context) ProbeResult
+}
+
+// HTTP204Probe expects 204 (or an empty 200) from a generate_204 style URL
+// and flags anything else as a captive portal.
+type HTTP204Probe struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p *HTTP204Probe) Name() string { return "http " + p.URL }
+
+func (p *HTTP204Probe) Run(ctx context.Context) ProbeResult {
+	r := ProbeResult{Name: p.Name()}
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, "GET", p.URL, nil)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	hc := *p.Client
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := hc.Do(req)
+	r.Latency = time.Since(start)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer resp.Body.Close()
+	n, _ := io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode == http.StatusNoContent, resp.StatusCode == http.StatusOK && n == 0:
+		r.OK = true
+	default:
+		r.Captive = true
+	}
+	return r
+}
+
+// DNSProbe resolves a name.
+type DNSProbe struct {
+	Host     string
+	Resolver *net.Resolver
+}
+
+func (p *DNSProbe) Name() string { return "dns " + p.Host }
+
+func (p *DNSProbe) Run(ctx context.Context) ProbeResult {
+	start := time.Now()
+	_, err := p.Resolver.LookupHost(ctx, p.Host)
+	return ProbeResult{Name: p.Name(), OK: err == nil, Err: err, Latency: time.Since(start)}
+}
+
+// TCPProbe connects to an address, normally an IP literal so it works
+// without DNS.
+type TCPProbe struct {
+	Addr    string
+	Network string // tcp, tcp4 or tcp6
+	Dial    func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+func (p *TCPProbe) Name() string { return "tcp " + p.Addr }
+
+func (p *TCPProbe) Run(ctx context.Context) ProbeResult {
+	start := time.Now()
+	conn, err := p.Dial(ctx, p.Network, p.Addr)
+	r := ProbeResult{Name: p.Name(), OK: err == nil, Err: err, Latency: time.Since(start)}
+	if conn != nil {
+		conn.Close()
+	}
+	return r
+}
+
+// portalProbeName is the Name of PortalProbe results.
+const portalProbeName = "portal"
+
+// PortalProbe asks the portal whether the session is logged in.
+type PortalProbe struct {
+	Driver PortalDriver
+}
+
+func (p *PortalProbe) Name() string { return portalProbeName }
+
+func (p *PortalProbe) Run(ctx context.Context) ProbeResult {
+	start := time.Now()
+	st, err := p.Driver.Status(ctx)
+	r := ProbeResult{Name: p.Name(), Latency: time.Since(start)}
+	switch {
+	case err == nil:
+		r.OK, r.LoggedIn = true, st.LoggedIn
+	case errors.Is(err, ErrNoStatusData):
+		// The portal answered; there is just no session.
+		r.OK = true
+	case errors.Is(err, ErrHTMLPage):
+		r.OK, r.Captive = true, true
+	default:
+		r.Err = err
+	}
+	return r
+}
+
+// ProbeConfig describes the probes of a Monitor.
+type ProbeConfig struct {
+	HTTP []string // generate_204 URLs
+	DNS  []string // Names to resolve
+	TCP  []string // host:port, preferably IP literals
+
+	Network   string // "tcp" (default), "tcp4" or "tcp6"
+	Interface string
+	TLS       *tls.Config
+	Timeout   time.Duration // Per probe, default 3s
+
+	// Portal adds an is_login probe through the driver's Status, asked
+	// only when the other probes disagree or fail.
+	Portal PortalDriver
+
+	// Quorum is the number of HTTP/TCP probes that must succeed (default 1).
+	Quorum int
+	// FailThreshold is the number of consecutive failed checks before an
+	// online link is reported as down (default 2).
+	FailThreshold int
+}
+
+// Monitor runs the probes and derives a NetState with hysteresis.
+type Monitor struct {
+	Internet []Prober // HTTP and TCP probes
+	DNS      []Prober
+	Portal   Prober // Optional
+
+	Quorum        int
+	FailThreshold int
+	Timeout       time.Duration
+
+	mu       sync.Mutex
+	state    NetState
+	failures int
+}
+
+// NewMonitor builds the probes described by pc.
+func NewMonitor(pc ProbeConfig) *Monitor {
+	network := pc.Network
+	if network == "" {
+		network = "tcp"
+	}
+	timeout := pc.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	dial := func(ctx context.Context, _, addr string) (net.Conn, error) {
+		return bindDialContext(pc.Interface)(ctx, network, addr)
+	}
+	transport := newTransport("", pc.TLS)
+	transport.DialContext = dial
+	client := &http.Client{Transport: transport, Timeout: timeout}
+
+	m := &Monitor{Quorum: pc.Quorum, FailThreshold: pc.FailThreshold, Timeout: timeout}
+	for _, u := range pc.HTTP {
+		m.Internet = append(m.Internet, &HTTP204Probe{URL: u, Client: client})
+	}
+	for _, a := range pc.TCP {
+		m.Internet = append(m.Internet, &TCPProbe{Addr: a, Network: network, Dial: dial})
+	}
+	resolver := net.DefaultResolver
+	if pc.Interface != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, netw, addr string) (net.Conn, error) {
+				return bindDialContext(pc.Interface)(ctx, netw, addr)
+			},
+		}
+	}
+	for _, h := range pc.DNS {
+		m.DNS = append(m.DNS, &DNSProbe{Host: h, Resolver: resolver})
+	}
+	if pc.Portal != nil {
+		m.Portal = &PortalProbe{Driver: pc.Portal}
+	}
+	return m
+}
+
+// State returns the last reported state.
+func (m *Monitor) State() NetState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Reset drops the hysteresis so the next Check reports its raw result,
+// for when the kernel reported a link or address change.
+func (m *Monitor) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state, m.failures = StateUnknown, 0
+}
+
+// Check runs the probes concurrently and returns the state after
+// hysteresis, plus the individual results. The portal is only asked when
+// the other probes do not all succeed.
+func (m *Monitor) Check(ctx context.Context) (NetState, []ProbeResult) {
+	internet := m.runAll(ctx, m.Internet)
+	dns := m.runAll(ctx, m.DNS)
+	var portal *ProbeResult
+	if m.Portal != nil && !(len(internet) > 0 && allOK(internet) && allOK(dns)) {
+		r := m.runAll(ctx, []Prober{m.Portal})[0]
+		portal = &r
+	}
+	quorum := m.Quorum
+	if quorum <= 0 {
+		quorum = 1
+	}
+	if quorum > len(m.Internet) && len(m.Internet) > 0 {
+		quorum = len(m.Internet)
+	}
+	raw := evaluateProbes(internet, dns, portal, quorum)
+
+	results := append(internet, dns...)
+	if portal != nil {
+		results = append(results, *portal)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	threshold := m.FailThreshold
+	if threshold <= 0 {
+		threshold = 2
+	}
+	if raw == StateOnline || m.state != StateOnline {
+		m.state, m.failures = raw, 0
+		return m.state, results
+	}
+	// Online until enough consecutive checks agree it is not.
+	m.failures++
+	if m.failures >= threshold {
+		m.state, m.failures = raw, 0
+	}
+	return m.state, results
+}
+
+func (m *Monitor) runAll(ctx context.Context, probes []Prober) []ProbeResult {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout+time.Second)
+	defer cancel()
+	out := make([]ProbeResult, len(probes))
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func(i int, p Prober) {
+			defer wg.Done()
+			out[i] = p.Run(ctx)
+		}(i, p)
+	}
+	wg.Wait()
+	return out
+}
+
+// allOK reports whether every result succeeded.
+func allOK(results []ProbeResult) bool {
+	for _, r := range results {
+		if !r.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluateProbes maps one round of results to a state.
+func evaluateProbes(internet, dns []ProbeResult, portal *ProbeResult, quorum int) NetState {
+	ok, captive := 0, false
+	for _, r := range internet {
+		if r.OK {
+			ok++
+		}
+		captive = captive || r.Captive
+	}
+	dnsOK := 0
+	for _, r := range dns {
+		if r.OK {
+			dnsOK++
+		}
+	}
+	dnsBroken := len(dns) > 0 && dnsOK == 0
+
+	switch {
+	case ok >= quorum && len(internet) > 0 && !dnsBroken:
+		return StateOnline
+	case len(internet) == 0 && portal != nil && portal.LoggedIn && !dnsBroken:
+		// Only the portal is probed; trust it.
+		return StateOnline
+	case captive:
+		return StateCaptivePortal
+	case portal != nil && portal.Captive:
+		return StateCaptivePortal
+	case portal != nil && portal.OK && !portal.LoggedIn:
+		return StateCaptivePortal
+	case dnsBroken && (ok > 0 || (portal != nil && portal.OK)):
+		return StateDNSBroken
+	case portal != nil && portal.Err != nil:
+		if dnsOK > 0 {
+			return StatePortalUnreachable
+		}
+		return StateNoLink
+	case portal != nil || dnsOK > 0:
+		return StateUpstreamDown
+	}
+	return StateNoLink
+}
@@ -0,0 +1,143 @@
+package drcom
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEvaluateProbes(t *testing.T) {
+	ok := ProbeResult{OK: true}
+	fail := ProbeResult{Err: errors.New("timeout")}
+	captive := ProbeResult{Captive: true}
+	loggedIn := &ProbeResult{OK: true, LoggedIn: true}
+	noSession := &ProbeResult{OK: true}
+	loginPage := &ProbeResult{OK: true, Captive: true}
+	portalDown := &ProbeResult{Err: errors.New("refused")}
+
+	tests := []struct {
+		name     string
+		internet []ProbeResult
+		dns      []ProbeResult
+		portal   *ProbeResult
+		quorum   int
+		want     NetState
+	}{
+		{"all up", []ProbeResult{ok, ok}, []ProbeResult{ok}, nil, 1, StateOnline},
+		{"quorum met", []ProbeResult{ok, fail, fail}, nil, nil, 1, StateOnline},
+		{"quorum missed", []ProbeResult{ok, fail, fail}, nil, nil, 2, StateNoLink},
+		{"quorum missed, portal logged in", []ProbeResult{ok, fail}, nil, loggedIn, 2, StateUpstreamDown},
+		{"redirected", []ProbeResult{captive, fail}, nil, nil, 1, StateCaptivePortal},
+		{"portal login page", []ProbeResult{fail}, nil, loginPage, 1, StateCaptivePortal},
+		{"portal has no session", []ProbeResult{fail}, []ProbeResult{ok}, noSession, 1, StateCaptivePortal},
+		{"names do not resolve", []ProbeResult{ok}, []ProbeResult{fail}, nil, 1, StateDNSBroken},
+		{"portal down, DNS up", []ProbeResult{fail}, []ProbeResult{ok}, portalDown, 1, StatePortalUnreachable},
+		{"portal down, nothing answers", []ProbeResult{fail}, []ProbeResult{fail}, portalDown, 1, StateNoLink},
+		{"uplink down", []ProbeResult{fail}, []ProbeResult{ok}, loggedIn, 1, StateUpstreamDown},
+		{"only the portal", nil, nil, loggedIn, 1, StateOnline},
+		{"nothing", []ProbeResult{fail}, nil, nil, 1, StateNoLink},
+	}
+	for _, tt := range tests {
+		if got := evaluateProbes(tt.internet, tt.dns, tt.portal, tt.quorum); got != tt.want {
+			t.Errorf("%s: state %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// probeServers are generate_204 stand-ins: one answering 204, one
+// redirecting to a login page and one that is down.
+func probeServers(t *testing.T) (up, redirect, down string) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(ok.Close)
+	captive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://10.0.0.1/a79.htm", http.StatusFound)
+	}))
+	t.Cleanup(captive.Close)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	return ok.URL, captive.URL, closed.URL
+}
+
+func TestMonitorCheck(t *testing.T) {
+	up, redirect, down := probeServers(t)
+	tests := []struct {
+		name        string
+		http        []string
+		quorum      int
+		driver      *fakeDriver
+		want        NetState
+		statusCalls int32
+	}{
+		{"all up", []string{up, up}, 1, &fakeDriver{}, StateOnline, 0},
+		{"probes disagree", []string{up, down}, 1, &fakeDriver{loggedIn: true}, StateOnline, 1},
+		{"quorum missed", []string{up, down}, 2, &fakeDriver{loggedIn: true}, StateUpstreamDown, 1},
+		{"captive redirect", []string{redirect, down}, 1, &fakeDriver{statusErr: ErrNoStatusData}, StateCaptivePortal, 1},
+		{"portal has no session", []string{down}, 1, &fakeDriver{statusErr: ErrNoStatusData}, StateCaptivePortal, 1},
+		{"portal down", []string{down}, 1, &fakeDriver{statusErr: errors.New("refused")}, StateNoLink, 1},
+		{"only the portal", nil, 1, &fakeDriver{loggedIn: true}, StateOnline, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMonitor(ProbeConfig{HTTP: tt.http, Portal: tt.driver, Quorum: tt.quorum, Timeout: time.Second})
+			state, results := m.Check(context.Background())
+			if state != tt.want {
+				t.Fatalf("state %v, want %v (%+v)", state, tt.want, results)
+			}
+			if n := tt.driver.statusCalls.Load(); n != tt.statusCalls {
+				t.Fatalf("%d portal queries, want %d", n, tt.statusCalls)
+			}
+			if tt.statusCalls > 0 && portalResult(results) == nil {
+				t.Fatalf("portal result missing from %+v", results)
+			}
+		})
+	}
+}
+
+func TestMonitorHysteresis(t *testing.T) {
+	var online atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if online.Load() {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Redirect(w, r, "http://10.0.0.1/", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	m := NewMonitor(ProbeConfig{HTTP: []string{srv.URL}, FailThreshold: 3, Timeout: time.Second})
+	steps := []struct {
+		name   string
+		online bool
+		reset  bool
+		want   NetState
+	}{
+		{"starts captive", false, false, StateCaptivePortal},
+		{"comes online at once", true, false, StateOnline},
+		{"first failure held", false, false, StateOnline},
+		{"second failure held", false, false, StateOnline},
+		{"third failure reported", false, false, StateCaptivePortal},
+		{"back online", true, false, StateOnline},
+		{"failure held again", false, false, StateOnline},
+		{"success clears the count", true, false, StateOnline},
+		{"count starts over", false, false, StateOnline},
+		{"reset reports at once", false, true, StateCaptivePortal},
+	}
+	for _, st := range steps {
+		online.Store(st.online)
+		if st.reset {
+			m.Reset()
+		}
+		if got, _ := m.Check(context.Background()); got != st.want {
+			t.Fatalf("%s: state %v, want %v", st.name, got, st.want)
+		}
+		if m.State() != st.want {
+			t.Fatalf("%s: State() %v", st.name, m.State())
+		}
+	}
+}
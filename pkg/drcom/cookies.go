@@ -0,0 +1,108 @@
+package drcom
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileJar is a cookie jar saved to a JSON file after every change, so a
+// portal session survives restarts of the tool.
+type FileJar struct {
+	jar  *cookiejar.Jar
+	path string
+
+	mu      sync.Mutex
+	cookies map[string][]*http.Cookie // Keyed by scheme://host
+}
+
+// NewFileJar loads the jar stored at path; a missing file is an empty jar.
+func NewFileJar(path string) (*FileJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	j := &FileJar{jar: jar, path: path, cookies: make(map[string][]*http.Cookie)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &j.cookies); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for origin, cs := range j.cookies {
+		u, err := url.Parse(origin)
+		if err != nil {
+			delete(j.cookies, origin)
+			continue
+		}
+		live := cs[:0]
+		for _, c := range cs {
+			if c.Expires.IsZero() || c.Expires.After(now) {
+				live = append(live, c)
+			}
+		}
+		j.cookies[origin] = live
+		jar.SetCookies(u, live)
+	}
+	return j, nil
+}
+
+func (j *FileJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+func (j *FileJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	origin := u.Scheme + "://" + u.Host
+	stored := j.cookies[origin]
+	for _, c := range cookies {
+		replaced := false
+		for i, old := range stored {
+			if old.Name == c.Name && old.Path == c.Path {
+				stored[i], replaced = c, true
+				break
+			}
+		}
+		if !replaced {
+			stored = append(stored, c)
+		}
+	}
+	j.cookies[origin] = stored
+	j.save()
+}
+
+// save writes the jar; errors are ignored since the in-memory jar keeps
+// working and the next change retries.
+func (j *FileJar) save() {
+	data, err := json.Marshal(j.cookies)
+	if err != nil {
+		return
+	}
+	writeFileAtomic(j.path, data)
+}
+
+// writeFileAtomic replaces path with data (mode 0600), creating the
+// directory if needed.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,75 @@
+package drcom
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileJar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "cookies.json")
+	portal, _ := url.Parse("http://10.0.0.1/eportal/index.jsp")
+	other, _ := url.Parse("http://192.168.1.1/")
+
+	jar, err := NewFileJar(path)
+	if err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	jar.SetCookies(portal, []*http.Cookie{
+		{Name: "JSESSIONID", Value: "s1", Path: "/"},
+		{Name: "lang", Value: "zh", Path: "/"},
+		{Name: "old", Value: "x", Path: "/", Expires: time.Now().Add(time.Hour)},
+	})
+	// Same name and path replaces, another path adds.
+	jar.SetCookies(portal, []*http.Cookie{
+		{Name: "JSESSIONID", Value: "s2", Path: "/"},
+		{Name: "lang", Value: "en", Path: "/eportal"},
+	})
+	jar.SetCookies(other, []*http.Cookie{{Name: "token", Value: "t", Path: "/"}})
+
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("saved jar: %v, %v", fi, err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left behind: %v", err)
+	}
+
+	// Expire one cookie in the file, as if time had passed.
+	jar.mu.Lock()
+	for _, c := range jar.cookies["http://10.0.0.1"] {
+		if c.Name == "old" {
+			c.Expires = time.Now().Add(-time.Minute)
+		}
+	}
+	jar.save()
+	jar.mu.Unlock()
+
+	loaded, err := NewFileJar(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	got := map[string]string{}
+	for _, c := range loaded.Cookies(portal) {
+		got[c.Name] += c.Value + ";"
+	}
+	// Cookies come back most specific path first.
+	want := map[string]string{"JSESSIONID": "s2;", "lang": "en;zh;"}
+	if len(got) != len(want) || got["JSESSIONID"] != want["JSESSIONID"] || got["lang"] != want["lang"] {
+		t.Fatalf("portal cookies %v, want %v", got, want)
+	}
+	if cs := loaded.Cookies(other); len(cs) != 1 || cs[0].Value != "t" {
+		t.Fatalf("other host cookies %v", cs)
+	}
+	if n := len(loaded.cookies["http://10.0.0.1"]); n != 3 {
+		t.Fatalf("%d portal cookies kept after reload, want the 3 live ones", n)
+	}
+
+	os.WriteFile(path, []byte("{not json"), 0600)
+	if _, err := NewFileJar(path); err == nil {
+		t.Fatal("corrupt jar file loaded")
+	}
+}
@@ -0,0 +1,216 @@
+package drcom
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+var (
+	// ErrHTMLPage means the portal answered with an HTML page where data
+	// was expected, typically a captive or error page.
+	ErrHTMLPage = errors.New("portal returned an HTML page")
+	// ErrMaintenance is an HTML page announcing maintenance.
+	ErrMaintenance = errors.New("portal is under maintenance")
+)
+
+var (
+	metaCharsetRe = regexp.MustCompile(`(?i)<meta[^>]+charset=["']?([\w-]+)`)
+	htmlTitleRe   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	jsonpRe       = regexp.MustCompile(`^[\w$.]+\s*\(`)
+)
+
+// maintenanceWords mark maintenance pages; checked against the lowercased page.
+// A bare "维护" is too common (e.g. "信息维护" menus) to count.
+var maintenanceWords = []string{"系统维护", "维护中", "正在维护", "升级中", "暂停服务", "maintenance", "service unavailable"}
+
+// HTMLPageError is returned when an HTML page comes back instead of JSON.
+type HTMLPageError struct {
+	Title       string
+	Maintenance bool
+}
+
+func (e *HTMLPageError) Error() string {
+	kind := "HTML page"
+	if e.Maintenance {
+		kind = "maintenance page"
+	}
+	if e.Title == "" {
+		return "portal returned a " + kind
+	}
+	return fmt.Sprintf("portal returned a %s: %q", kind, e.Title)
+}
+
+func (e *HTMLPageError) Is(target error) bool {
+	return target == ErrHTMLPage || (e.Maintenance && target == ErrMaintenance)
+}
+
+// newHTMLPageError describes an HTML body.
+func newHTMLPageError(body string) *HTMLPageError {
+	e := &HTMLPageError{}
+	if m := htmlTitleRe.FindStringSubmatch(body); m != nil {
+		e.Title = strings.TrimSpace(m[1])
+	}
+	lower := strings.ToLower(body)
+	for _, w := range maintenanceWords {
+		if strings.Contains(lower, w) {
+			e.Maintenance = true
+			break
+		}
+	}
+	return e
+}
+
+// decodeBody converts a response body to UTF-8, using the charset from the
+// Content-Type header or a <meta> tag, and GB18030 (a superset of GBK) for
+// bodies that are not valid UTF-8 and declare nothing.
+func decodeBody(data []byte, contentType string) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	charset := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		charset = strings.ToLower(params["charset"])
+	}
+	if charset == "" {
+		head := data
+		if len(head) > 1024 {
+			head = head[:1024]
+		}
+		if m := metaCharsetRe.FindSubmatch(head); m != nil {
+			charset = strings.ToLower(string(m[1]))
+		}
+	}
+	switch charset {
+	case "gbk", "gb2312", "gb18030", "x-gbk":
+	case "":
+		if utf8.Valid(data) {
+			return string(data)
+		}
+	default:
+		return string(data)
+	}
+	out, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(out)
+}
+
+// snippet shortens a body for error messages.
+func snippet(s string) string {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) <= 120 {
+		return s
+	}
+	return string([]rune(s)[:120]) + "..."
+}
+
+// unwrapJSONP returns the JSON inside callback(...), or the content itself
+// if it is plain JSON.
+func unwrapJSONP(content string) (string, error) {
+	s := strings.TrimSpace(content)
+	if strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[") {
+		return s, nil
+	}
+	if strings.HasPrefix(s, "<") {
+		return "", newHTMLPageError(s)
+	}
+	if loc := jsonpRe.FindStringIndex(s); loc != nil {
+		end := strings.LastIndex(s, ")")
+		if end > loc[1] {
+			return strings.TrimSpace(s[loc[1]:end]), nil
+		}
+	}
+	return "", fmt.Errorf("unexpected portal response: %s", snippet(s))
+}
+
+// rawHolder is implemented by responses that keep every field they got.
+type rawHolder interface {
+	setFields(map[string]interface{})
+}
+
+// parseJSONP decodes JSON or JSONP with any callback name into v. HTML
+// answers yield an *HTMLPageError.
+func parseJSONP(content string, v interface{}) error {
+	jsonStr, err := unwrapJSONP(content)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(jsonStr), v); err != nil {
+		return fmt.Errorf("failed to parse JSON: %v, content: %s", err, snippet(jsonStr))
+	}
+	if h, ok := v.(rawHolder); ok {
+		var fields map[string]interface{}
+		if json.Unmarshal([]byte(jsonStr), &fields) == nil {
+			h.setFields(fields)
+		}
+	}
+	return nil
+}
+
+// Number is a JSON number that portals sometimes send as a string. Empty
+// strings, null and unparsable values decode as 0.
+type Number float64
+
+func (n *Number) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		*n = 0
+		return nil
+	}
+	*n = Number(f)
+	return nil
+}
+
+// Text is a JSON string that portals sometimes send as a number or null.
+type Text string
+
+func (t *Text) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = Text(s)
+		return nil
+	}
+	if string(b) == "null" {
+		*t = ""
+		return nil
+	}
+	*t = Text(strings.TrimSpace(string(b)))
+	return nil
+}
+
+func (t Text) String() string { return string(t) }
+
+// UserDataList is the status "data" field, which some builds send as a
+// single object instead of an array.
+type UserDataList []UserData
+
+func (l *UserDataList) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case len(b) == 0 || string(b) == "null" || string(b) == `""`:
+		*l = nil
+		return nil
+	case b[0] == '{':
+		var d UserData
+		if err := json.Unmarshal(b, &d); err != nil {
+			return err
+		}
+		*l = UserDataList{d}
+		return nil
+	}
+	var list []UserData
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
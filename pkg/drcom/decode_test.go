@@ -0,0 +1,46 @@
+package drcom
+
+import "testing"
+
+func TestUserDataList(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+		flow float64
+	}{
+		{`dr1({"code":"1","data":[{"USERFLOW":"1024","USERMONEY":3.5}]})`, 1, 1024},
+		{`dr1({"code":"1","data":{"USERFLOW":2048,"USERMONEY":"3.5"}})`, 1, 2048},
+		{`dr1({"code":"1","data":[]})`, 0, 0},
+		{`dr1({"code":"0","data":null})`, 0, 0},
+		{`dr1({"code":"0","data":""})`, 0, 0},
+		{`dr1({"code":"0"})`, 0, 0},
+	}
+	for _, tt := range tests {
+		var res UserInfoResponse
+		if err := parseJSONP(tt.body, &res); err != nil {
+			t.Errorf("%s: %v", tt.body, err)
+			continue
+		}
+		if len(res.Data) != tt.want || (tt.want > 0 && float64(res.Data[0].UserFlow) != tt.flow) {
+			t.Errorf("%s: data %+v", tt.body, res.Data)
+		}
+	}
+}
+
+func TestMaintenancePage(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`<html><title>系统维护</title><body>系统维护中，请稍后再试</body></html>`, true},
+		{`<html><body>网络正在维护，预计 2 小时后恢复</body></html>`, true},
+		{`<html><body>Scheduled Maintenance</body></html>`, true},
+		{`<html><title>登录</title><body><a href="/self">个人信息维护</a></body></html>`, false},
+		{`<html><title>404 Not Found</title></html>`, false},
+	}
+	for _, tt := range tests {
+		if got := newHTMLPageError(tt.body).Maintenance; got != tt.want {
+			t.Errorf("%s: maintenance = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
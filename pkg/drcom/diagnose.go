@@ -0,0 +1,194 @@
+package drcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Cause is the diagnosed reason for an outage.
+type Cause int
+
+const (
+	CauseUnknown      Cause = iota
+	CauseNone               // Nothing wrong (any more)
+	CauseNoCarrier          // Cable unplugged, Wi-Fi not associated or interface down
+	CauseNoAddress          // No usable IPv4 address, usually a DHCP failure
+	CauseGatewayDown        // Default gateway does not answer
+	CausePortalDown         // Portal does not answer although the LAN works
+	CauseLoggedOut          // Portal answers and says we are not logged in
+	CauseDNS                // Name resolution is broken
+	CauseUpstreamDown       // Logged in, but the campus uplink is down
+)
+
+var causeNames = map[Cause]string{
+	CauseUnknown:      "unknown",
+	CauseNone:         "none",
+	CauseNoCarrier:    "no_carrier",
+	CauseNoAddress:    "no_address",
+	CauseGatewayDown:  "gateway_down",
+	CausePortalDown:   "portal_down",
+	CauseLoggedOut:    "logged_out",
+	CauseDNS:          "dns",
+	CauseUpstreamDown: "upstream_down",
+}
+
+func (c Cause) String() string {
+	if n, ok := causeNames[c]; ok {
+		return n
+	}
+	return "unknown"
+}
+
+func (c Cause) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// NeedsLogin reports whether logging in can fix the outage. Unknown
+// causes get a login attempt, which is what the daemon always did.
+func (c Cause) NeedsLogin() bool {
+	return c == CauseLoggedOut || c == CauseUnknown
+}
+
+// Diagnosis is the result of Diagnose.
+type Diagnosis struct {
+	Cause     Cause
+	Interface string
+	Address   net.IP
+	Gateway   net.IP
+	Detail    string
+}
+
+// DiagnoseConfig is the input of Diagnose.
+type DiagnoseConfig struct {
+	Host      string       // Portal URL
+	Interface string       // Configured interface, detected if empty
+	Driver    PortalDriver // Used for the portal and login checks
+	State     NetState     // From the probes; CaptivePortal skips the portal checks
+	// Results of the same check; a portal probe among them is reused
+	// instead of asking the portal again.
+	Results []ProbeResult
+}
+
+// Diagnose walks the path to the internet from the bottom up: carrier,
+// address, gateway, portal, login state.
+func Diagnose(ctx context.Context, dc DiagnoseConfig) *Diagnosis {
+	d := &Diagnosis{Interface: dc.Interface}
+	portalIP := resolveHost(dc.Host)
+	if d.Interface == "" {
+		if la, err := DetectLocalAddr(dc.Host, ""); err == nil {
+			d.Interface = la.Interface
+		} else if portalIP != nil {
+			d.Interface, _, _ = routeFor(portalIP)
+		}
+	}
+	if d.Interface == "" {
+		d.Cause, d.Detail = CauseNoAddress, "no interface leads to the portal"
+		return d
+	}
+
+	if up, err := linkUp(d.Interface); err != nil || !up {
+		d.Cause = CauseNoCarrier
+		d.Detail = fmt.Sprintf("%s has no carrier", d.Interface)
+		if err != nil {
+			d.Detail = err.Error()
+		}
+		return d
+	}
+	ip, err := interfaceIP(d.Interface, false)
+	if err != nil {
+		d.Cause, d.Detail = CauseNoAddress, err.Error()
+		return d
+	}
+	d.Address = ip
+
+	if portalIP != nil {
+		if ifn, gw, err := routeFor(portalIP); err == nil && gw != nil && ifn == d.Interface {
+			d.Gateway = gw
+			if !hostAlive(ctx, gw, d.Interface) {
+				d.Cause = CauseGatewayDown
+				d.Detail = fmt.Sprintf("gateway %s does not answer", gw)
+				return d
+			}
+		}
+	}
+
+	switch dc.State {
+	case StateCaptivePortal:
+		d.Cause, d.Detail = CauseLoggedOut, "traffic is redirected to the portal"
+		return d
+	case StateDNSBroken:
+		d.Cause, d.Detail = CauseDNS, "names do not resolve"
+		return d
+	}
+	if r := portalResult(dc.Results); r != nil {
+		d.Cause, d.Detail = portalCause(*r)
+		return d
+	}
+	if dc.Driver == nil {
+		return d
+	}
+
+	if err := dc.Driver.Probe(ctx); err != nil {
+		d.Cause, d.Detail = CausePortalDown, err.Error()
+		return d
+	}
+	st, err := dc.Driver.Status(ctx)
+	switch {
+	case errors.Is(err, ErrNoStatusData), err == nil && !st.LoggedIn:
+		d.Cause, d.Detail = CauseLoggedOut, "the portal reports no session"
+	case err != nil:
+		d.Detail = err.Error()
+	default:
+		d.Cause, d.Detail = CauseUpstreamDown, "logged in, but the internet is unreachable"
+	}
+	return d
+}
+
+// portalResult finds the portal probe among a check's results.
+func portalResult(results []ProbeResult) *ProbeResult {
+	for i := range results {
+		if results[i].Name == portalProbeName {
+			return &results[i]
+		}
+	}
+	return nil
+}
+
+// portalCause maps a portal probe result to a cause.
+func portalCause(r ProbeResult) (Cause, string) {
+	switch {
+	case r.Err != nil:
+		return CausePortalDown, r.Err.Error()
+	case r.Captive:
+		return CauseLoggedOut, "the portal answers with its login page"
+	case !r.LoggedIn:
+		return CauseLoggedOut, "the portal reports no session"
+	}
+	return CauseUpstreamDown, "logged in, but the internet is unreachable"
+}
+
+// hostAlive reports whether ip answers on the LAN: a known ARP entry, or
+// any TCP answer (a refused connection counts) on a common port.
+func hostAlive(ctx context.Context, ip net.IP, ifname string) bool {
+	for _, port := range []string{"53", "80"} {
+		d, err := interfaceDialer(ifname, "tcp4")
+		if err != nil {
+			return false
+		}
+		d.Timeout = time.Second
+		conn, err := d.DialContext(ctx, "tcp4", net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return true
+		}
+	}
+	// The dial attempts have populated the ARP table if the host exists.
+	return neighborKnown(ip)
+}
@@ -0,0 +1,99 @@
+package drcom
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeDriver answers Status and Probe with fixed results and counts the
+// calls.
+type fakeDriver struct {
+	loggedIn  bool
+	statusErr error
+	probeErr  error
+
+	statusCalls atomic.Int32
+	probeCalls  atomic.Int32
+}
+
+func (d *fakeDriver) Login(ctx context.Context) (*LoginResult, error) {
+	return &LoginResult{Outcome: OutcomeSuccess}, nil
+}
+
+func (d *fakeDriver) Logout(ctx context.Context) error { return nil }
+
+func (d *fakeDriver) Status(ctx context.Context) (*AccountStatus, error) {
+	d.statusCalls.Add(1)
+	if d.statusErr != nil {
+		return nil, d.statusErr
+	}
+	return &AccountStatus{LoggedIn: d.loggedIn}, nil
+}
+
+func (d *fakeDriver) Probe(ctx context.Context) error {
+	d.probeCalls.Add(1)
+	return d.probeErr
+}
+
+func TestPortalCause(t *testing.T) {
+	tests := []struct {
+		name string
+		r    ProbeResult
+		want Cause
+	}{
+		{"unreachable", ProbeResult{Err: errors.New("connection refused")}, CausePortalDown},
+		{"login page", ProbeResult{OK: true, Captive: true}, CauseLoggedOut},
+		{"no session", ProbeResult{OK: true}, CauseLoggedOut},
+		{"logged in", ProbeResult{OK: true, LoggedIn: true}, CauseUpstreamDown},
+	}
+	for _, tt := range tests {
+		if got, _ := portalCause(tt.r); got != tt.want {
+			t.Errorf("%s: cause %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	if up, err := linkUp("lo"); err != nil || !up {
+		t.Skip("no loopback interface named lo")
+	}
+	portal := func(r ProbeResult) []ProbeResult {
+		r.Name = portalProbeName
+		return []ProbeResult{{Name: "http x", Err: errors.New("timeout")}, r}
+	}
+	tests := []struct {
+		name    string
+		state   NetState
+		results []ProbeResult
+		driver  *fakeDriver
+		want    Cause
+		calls   int32 // Driver calls, Probe and Status together
+	}{
+		{"captive", StateCaptivePortal, nil, &fakeDriver{}, CauseLoggedOut, 0},
+		{"dns", StateDNSBroken, nil, &fakeDriver{}, CauseDNS, 0},
+		{"portal result, no session", StateUpstreamDown, portal(ProbeResult{OK: true}), &fakeDriver{loggedIn: true}, CauseLoggedOut, 0},
+		{"portal result, logged in", StateUpstreamDown, portal(ProbeResult{OK: true, LoggedIn: true}), &fakeDriver{}, CauseUpstreamDown, 0},
+		{"portal result, down", StatePortalUnreachable, portal(ProbeResult{Err: errors.New("refused")}), &fakeDriver{}, CausePortalDown, 0},
+		{"no portal probe, logged in", StateUpstreamDown, nil, &fakeDriver{loggedIn: true}, CauseUpstreamDown, 2},
+		{"no portal probe, no session", StateUpstreamDown, nil, &fakeDriver{statusErr: ErrNoStatusData}, CauseLoggedOut, 2},
+		{"no portal probe, down", StateNoLink, nil, &fakeDriver{probeErr: errors.New("refused")}, CausePortalDown, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Diagnose(context.Background(), DiagnoseConfig{
+				Interface: "lo",
+				Driver:    tt.driver,
+				State:     tt.state,
+				Results:   tt.results,
+			})
+			if d.Cause != tt.want {
+				t.Fatalf("cause %v (%s), want %v", d.Cause, d.Detail, tt.want)
+			}
+			if calls := tt.driver.statusCalls.Load() + tt.driver.probeCalls.Load(); calls != tt.calls {
+				t.Fatalf("%d driver calls, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
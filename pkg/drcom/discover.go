@@ -0,0 +1,126 @@
+package drcom
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DefaultProbeURL is requested to trigger the captive redirect. Any
+// plain-HTTP address outside the campus network works.
+const DefaultProbeURL = "http://123.123.123.123/"
+
+// maxRedirects bounds the hops followed during discovery.
+const maxRedirects = 5
+
+var (
+	jsRedirectRe  = regexp.MustCompile(`location\.(?:href\s*=|replace\()\s*['"]([^'"]+)['"]`)
+	metaRefreshRe = regexp.MustCompile(`(?i)<meta[^>]+http-equiv=["']?refresh["']?[^>]+url=([^"'>\s]+)`)
+	eportalBaseRe = regexp.MustCompile(`(https?://[\w.\-]+(?::\d+)?)/eportal/`)
+	eportalPortRe = regexp.MustCompile(`epHTTPPort\s*[:=]\s*['"]?(\d+)`)
+	errNoRedirect = errors.New("no captive redirect found (already online?)")
+)
+
+// acParamAliases maps the spellings used by older redirects to the ePortal
+// login parameter names.
+var acParamAliases = map[string]string{
+	"wlanuserip":   "wlan_user_ip",
+	"wlanuseripv6": "wlan_user_ipv6",
+	"wlanusermac":  "wlan_user_mac",
+	"wlanacip":     "wlan_ac_ip",
+	"wlanacname":   "wlan_ac_name",
+}
+
+// PortalInfo is what a captive redirect reveals about the portal.
+type PortalInfo struct {
+	Host     string            // API base, scheme://host[:port]
+	LoginURL string            // Page the redirect chain ended on
+	Params   map[string]string // wlan_* parameters, canonical names
+}
+
+// ACParams returns the access-controller parameters, which stay the same
+// across sessions, as opposed to the per-session user address.
+func (p *PortalInfo) ACParams() map[string]string {
+	ac := make(map[string]string)
+	for k, v := range p.Params {
+		if strings.HasPrefix(k, "wlan_ac_") && v != "" {
+			ac[k] = v
+		}
+	}
+	return ac
+}
+
+// DiscoverPortal requests probeURL (DefaultProbeURL if empty) over plain
+// HTTP, follows the captive redirect and extracts the portal address and
+// its query parameters.
+func DiscoverPortal(ctx context.Context, probeURL string, opts ...Option) (*PortalInfo, error) {
+	return NewClient("", "", "", opts...).discover(ctx, probeURL)
+}
+
+func (c *DrComClient) discover(ctx context.Context, probeURL string) (*PortalInfo, error) {
+	if probeURL == "" {
+		probeURL = DefaultProbeURL
+	}
+	info := &PortalInfo{Params: make(map[string]string)}
+	current, err := url.Parse(probeURL)
+	if err != nil {
+		return nil, err
+	}
+	var body string
+	for hop := 0; hop <= maxRedirects; hop++ {
+		var location string
+		location, body, err = c.fetchNoRedirect(ctx, current.String())
+		if err != nil {
+			if hop == 0 {
+				return nil, err
+			}
+			// The landing page itself may be unreachable; the redirect
+			// already told us enough.
+			body = ""
+			break
+		}
+		if location == "" {
+			location = redirectInBody(body)
+		}
+		if location == "" {
+			break
+		}
+		next, err := current.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		current = next
+		info.LoginURL = current.String()
+		for k, vs := range current.Query() {
+			if alias, ok := acParamAliases[strings.ToLower(k)]; ok {
+				k = alias
+			}
+			if strings.HasPrefix(k, "wlan_") && len(vs) > 0 {
+				info.Params[k] = vs[0]
+			}
+		}
+	}
+	if info.LoginURL == "" {
+		return nil, errNoRedirect
+	}
+	info.Host = current.Scheme + "://" + current.Host
+	if m := eportalBaseRe.FindStringSubmatch(body); m != nil {
+		info.Host = m[1]
+	} else if m := eportalPortRe.FindStringSubmatch(body); m != nil {
+		info.Host = current.Scheme + "://" + current.Hostname() + ":" + m[1]
+	}
+	return info, nil
+}
+
+// redirectInBody finds a script or meta-refresh redirect in a page.
+func redirectInBody(body string) string {
+	if m := jsRedirectRe.FindStringSubmatch(body); m != nil {
+		return m[1]
+	}
+	if m := metaRefreshRe.FindStringSubmatch(body); m != nil {
+		return m[1]
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package drcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedirectInBody(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`<script>location.href = "http://10.0.0.1/eportal/index.jsp?wlanuserip=10.0.0.2"</script>`, "http://10.0.0.1/eportal/index.jsp?wlanuserip=10.0.0.2"},
+		{`<script>top.self.location.href='http://10.0.0.1/a.htm?x=1'</script>`, "http://10.0.0.1/a.htm?x=1"},
+		{`<script>window.location.replace("/login?ip=1")</script>`, "/login?ip=1"},
+		{`<META HTTP-EQUIV="Refresh" CONTENT="0; URL=http://10.0.0.1/a.htm">`, "http://10.0.0.1/a.htm"},
+		{`<meta http-equiv=refresh content="1;url=/portal?ac=2">`, "/portal?ac=2"},
+		{`<html><body>ok</body></html>`, ""},
+		{`var loc = location.pathname;`, ""},
+	}
+	for _, tt := range tests {
+		if got := redirectInBody(tt.body); got != tt.want {
+			t.Errorf("redirectInBody(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestDiscoverPortal(t *testing.T) {
+	portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/online":
+			w.WriteHeader(http.StatusNoContent)
+		case "/302":
+			http.Redirect(w, r, "/a79.htm?wlanuserip=10.0.0.2&wlanacname=HW-AC&wlanacip=10.0.0.254&wlan_user_mac=aabbccddeeff", http.StatusFound)
+		case "/js":
+			fmt.Fprint(w, `<script>location.href="/a79.htm?wlan_user_ip=10.0.0.3&wlan_ac_name=AC2"</script>`)
+		case "/meta":
+			fmt.Fprint(w, `<meta http-equiv="refresh" content="0;url=/js">`)
+		case "/base":
+			http.Redirect(w, r, "/index.htm?wlanacname=AC3", http.StatusFound)
+		case "/index.htm":
+			fmt.Fprint(w, `<script src="http://10.9.8.7:801/eportal/portal.js"></script>`)
+		case "/port":
+			http.Redirect(w, r, "/page.htm?wlanacname=AC4", http.StatusFound)
+		case "/page.htm":
+			fmt.Fprint(w, `<script>var epHTTPPort = '801';</script>`)
+		case "/loop":
+			http.Redirect(w, r, "/loop?wlanacname=AC5", http.StatusFound)
+		default:
+			fmt.Fprint(w, "<html>login</html>")
+		}
+	}))
+	defer portal.Close()
+	hostname := strings.Split(strings.TrimPrefix(portal.URL, "http://"), ":")[0]
+
+	tests := []struct {
+		path   string
+		host   string
+		login  string // Suffix of the login URL
+		params map[string]string
+		ac     string
+	}{
+		{
+			path:  "/302",
+			host:  portal.URL,
+			login: "/a79.htm?wlanuserip=10.0.0.2&wlanacname=HW-AC&wlanacip=10.0.0.254&wlan_user_mac=aabbccddeeff",
+			// Older spellings are mapped to the ePortal names.
+			params: map[string]string{"wlan_user_ip": "10.0.0.2", "wlan_ac_name": "HW-AC", "wlan_ac_ip": "10.0.0.254", "wlan_user_mac": "aabbccddeeff"},
+			ac:     "map[wlan_ac_ip:10.0.0.254 wlan_ac_name:HW-AC]",
+		},
+		{
+			path:   "/js",
+			host:   portal.URL,
+			login:  "/a79.htm?wlan_user_ip=10.0.0.3&wlan_ac_name=AC2",
+			params: map[string]string{"wlan_user_ip": "10.0.0.3", "wlan_ac_name": "AC2"},
+			ac:     "map[wlan_ac_name:AC2]",
+		},
+		{
+			// A meta refresh to a page with a script redirect.
+			path:   "/meta",
+			host:   portal.URL,
+			login:  "/a79.htm?wlan_user_ip=10.0.0.3&wlan_ac_name=AC2",
+			params: map[string]string{"wlan_user_ip": "10.0.0.3", "wlan_ac_name": "AC2"},
+			ac:     "map[wlan_ac_name:AC2]",
+		},
+		{
+			// The landing page names the ePortal API base.
+			path:   "/base",
+			host:   "http://10.9.8.7:801",
+			login:  "/index.htm?wlanacname=AC3",
+			params: map[string]string{"wlan_ac_name": "AC3"},
+			ac:     "map[wlan_ac_name:AC3]",
+		},
+		{
+			path:   "/port",
+			host:   "http://" + hostname + ":801",
+			login:  "/page.htm?wlanacname=AC4",
+			params: map[string]string{"wlan_ac_name": "AC4"},
+			ac:     "map[wlan_ac_name:AC4]",
+		},
+		{
+			// Redirect loops stop after maxRedirects hops.
+			path:   "/loop",
+			host:   portal.URL,
+			login:  "/loop?wlanacname=AC5",
+			params: map[string]string{"wlan_ac_name": "AC5"},
+			ac:     "map[wlan_ac_name:AC5]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			info, err := DiscoverPortal(context.Background(), portal.URL+tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Host != tt.host || !strings.HasSuffix(info.LoginURL, tt.login) {
+				t.Fatalf("host %s, login %s", info.Host, info.LoginURL)
+			}
+			if fmt.Sprint(info.Params) != fmt.Sprint(tt.params) {
+				t.Fatalf("params %v, want %v", info.Params, tt.params)
+			}
+			if got := fmt.Sprint(info.ACParams()); got != tt.ac {
+				t.Fatalf("AC params %s, want %s", got, tt.ac)
+			}
+		})
+	}
+
+	if _, err := DiscoverPortal(context.Background(), portal.URL+"/online"); !errors.Is(err, errNoRedirect) {
+		t.Fatalf("online: err %v, want errNoRedirect", err)
+	}
+}
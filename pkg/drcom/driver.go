@@ -0,0 +1,202 @@
+package drcom
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoginResult is the driver-independent result of a login attempt.
+type LoginResult struct {
+	Outcome LoginOutcome
+	Message string
+	Code    string      // Portal-specific result code, if any
+	Raw     interface{} // Original portal payload
+}
+
+// Err returns a *LoginError for failed outcomes, or nil.
+func (r *LoginResult) Err() error {
+	if r.Outcome.OK() {
+		return nil
+	}
+	return &LoginError{Outcome: r.Outcome, Msg: r.Message, RetCode: r.Code}
+}
+
+// PortalDriver is one campus authentication protocol. Transport failures are
+// returned as errors; a portal that answered but refused the login is
+// reported through LoginResult.Outcome.
+type PortalDriver interface {
+	Login(ctx context.Context) (*LoginResult, error)
+	Logout(ctx context.Context) error
+	Status(ctx context.Context) (*AccountStatus, error)
+	// Probe checks that the authentication server is reachable.
+	Probe(ctx context.Context) error
+}
+
+// DriverConfig is what a DriverFactory gets to build a driver.
+type DriverConfig struct {
+	Host     string
+	Username string
+	Password string
+	// Options configure the HTTP client of HTTP-based drivers.
+	Options []Option
+	// Settings holds driver-specific keys from auth.settings.
+	Settings Settings
+
+	// Local side overrides for drivers that do not use Options.
+	Interface string
+	IP        string
+	MAC       string
+}
+
+// DriverFactory creates a driver from its configuration.
+type DriverFactory func(cfg DriverConfig) (PortalDriver, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]DriverFactory)
+)
+
+// RegisterDriver makes a driver available by name. It panics if the name
+// is registered twice, like database/sql.Register.
+func RegisterDriver(name string, factory DriverFactory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if _, dup := drivers[name]; dup {
+		panic("drcom: RegisterDriver called twice for driver " + name)
+	}
+	drivers[name] = factory
+}
+
+// NewDriver creates the driver registered under name.
+func NewDriver(name string, cfg DriverConfig) (PortalDriver, error) {
+	if name == "" {
+		name = DriverEPortal
+	}
+	driversMu.RLock()
+	factory, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown auth driver %q (available: %s)", name, strings.Join(Drivers(), ", "))
+	}
+	return factory(cfg)
+}
+
+// Drivers returns the sorted names of the registered drivers.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// KeepAliver is implemented by drivers whose session has to be kept alive
+// by the client, such as the Dr.COM UDP protocols. KeepAlive blocks until
+// ctx is done or the session is lost.
+type KeepAliver interface {
+	KeepAlive(ctx context.Context) error
+}
+
+// HostReporter is implemented by HTTP drivers; Hosts reports the health of
+// each configured portal host (nil with a single host).
+type HostReporter interface {
+	Hosts() []HostHealth
+}
+
+// Settings holds driver-specific configuration values.
+type Settings map[string]string
+
+// String returns the value for key, or def if unset.
+func (s Settings) String(key, def string) string {
+	if v, ok := s[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// withDefaults returns a copy of s where unset keys take the given values.
+func (s Settings) withDefaults(defs map[string]string) Settings {
+	out := make(Settings, len(s)+len(defs))
+	for k, v := range defs {
+		out[k] = v
+	}
+	for k, v := range s {
+		if v != "" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Hex decodes a hex value such as "dc02" (an optional 0x prefix is allowed).
+func (s Settings) Hex(key string, def []byte) ([]byte, error) {
+	v := s.String(key, "")
+	if v == "" {
+		return def, nil
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(v), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("setting %s: %v", key, err)
+	}
+	return b, nil
+}
+
+// Seconds parses an integer number of seconds.
+func (s Settings) Seconds(key string, def time.Duration) (time.Duration, error) {
+	v := s.String(key, "")
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("setting %s: %v", key, err)
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+// IP parses an IP address setting; unset values yield nil.
+func (s Settings) IP(key string) (net.IP, error) {
+	v := s.String(key, "")
+	if v == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return nil, fmt.Errorf("setting %s: invalid IP %q", key, v)
+	}
+	return ip, nil
+}
+
+// MAC parses a hardware address setting; unset values yield nil.
+func (s Settings) MAC(key string) (net.HardwareAddr, error) {
+	v := s.String(key, "")
+	if v == "" {
+		return nil, nil
+	}
+	mac, err := ParseMAC(v)
+	if err != nil {
+		return nil, fmt.Errorf("setting %s: %v", key, err)
+	}
+	return mac, nil
+}
+
+// ParseMAC accepts the usual separators as well as bare "001122334455".
+func ParseMAC(s string) (net.HardwareAddr, error) {
+	if len(s) == 12 {
+		b, err := hex.DecodeString(s)
+		if err == nil {
+			return net.HardwareAddr(b), nil
+		}
+	}
+	return net.ParseMAC(s)
+}
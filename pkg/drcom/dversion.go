@@ -0,0 +1,468 @@
+package drcom
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DriverDVersion is the classic Dr.COM D-version UDP protocol (port 61440).
+const DriverDVersion = "drcom-d"
+
+const defaultUDPPort = "61440"
+
+// ErrSessionLost is returned by KeepAlive when the server stops answering.
+var ErrSessionLost = errors.New("keep-alive session lost")
+
+// ErrNoSession is returned by KeepAlive before a login of this client
+// succeeded, e.g. when the server reported the account already online.
+var ErrNoSession = errors.New("not logged in")
+
+// ErrNotLocalSession is returned by Status and Logout of the UDP drivers
+// when this process did not log in. Their session lives only in the
+// process that did, usually the daemon or API server.
+var ErrNotLocalSession = errors.New("session is only known to the process that logged in")
+
+func init() {
+	RegisterDriver(DriverDVersion, func(cfg DriverConfig) (PortalDriver, error) {
+		dc, err := NewDConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewDClient(dc), nil
+	})
+}
+
+// DConfig holds the D-version login parameters. The byte fields differ
+// between server builds and are usually copied from a packet capture of
+// the official client.
+type DConfig struct {
+	Server    string // host:port of the authentication server
+	Interface string // Optional interface to bind to
+	Username  string
+	Password  string
+
+	HostName   string
+	HostOS     string
+	HostIP     net.IP // Defaults to the local address facing Server
+	MAC        net.HardwareAddr
+	PrimaryDNS net.IP
+	DHCPServer net.IP
+
+	AuthVersion        []byte // 2 bytes, e.g. 0a00
+	KeepAliveVersion   []byte // 2 bytes, e.g. dc02
+	ControlCheckStatus byte
+	AdapterNum         byte
+	IPDog              byte
+
+	KeepAliveInterval time.Duration
+	Timeout           time.Duration
+}
+
+// NewDConfig reads a DConfig from the driver settings:
+// server, interface, host_name, host_os, host_ip, mac, primary_dns, dhcp_server,
+// auth_version, keep_alive_version, control_check_status, adapter_num,
+// ip_dog and keep_alive_interval (seconds).
+func NewDConfig(cfg DriverConfig) (DConfig, error) {
+	s := cfg.Settings
+	dc := DConfig{
+		Server:    udpServerAddr(s.String("server", cfg.Host)),
+		Interface: s.String("interface", cfg.Interface),
+		Username:  cfg.Username,
+		Password:  cfg.Password,
+		HostName:  s.String("host_name", "drcom-go"),
+		HostOS:    s.String("host_os", "Windows 10"),
+		Timeout:   3 * time.Second,
+	}
+	var err error
+	s = s.withDefaults(map[string]string{"host_ip": cfg.IP, "mac": cfg.MAC})
+	if dc.HostIP, err = s.IP("host_ip"); err != nil {
+		return dc, err
+	}
+	if dc.MAC, err = s.MAC("mac"); err != nil {
+		return dc, err
+	}
+	if dc.PrimaryDNS, err = s.IP("primary_dns"); err != nil {
+		return dc, err
+	}
+	if dc.DHCPServer, err = s.IP("dhcp_server"); err != nil {
+		return dc, err
+	}
+	if dc.AuthVersion, err = s.Hex("auth_version", []byte{0x0a, 0x00}); err != nil {
+		return dc, err
+	}
+	if dc.KeepAliveVersion, err = s.Hex("keep_alive_version", []byte{0xdc, 0x02}); err != nil {
+		return dc, err
+	}
+	if len(dc.AuthVersion) != 2 || len(dc.KeepAliveVersion) != 2 {
+		return dc, errors.New("auth_version and keep_alive_version must be 2 bytes")
+	}
+	single := func(key string, def byte) (byte, error) {
+		b, err := s.Hex(key, []byte{def})
+		if err != nil {
+			return 0, err
+		}
+		if len(b) != 1 {
+			return 0, fmt.Errorf("setting %s must be 1 byte", key)
+		}
+		return b[0], nil
+	}
+	if dc.ControlCheckStatus, err = single("control_check_status", 0x20); err != nil {
+		return dc, err
+	}
+	if dc.AdapterNum, err = single("adapter_num", 0x01); err != nil {
+		return dc, err
+	}
+	if dc.IPDog, err = single("ip_dog", 0x01); err != nil {
+		return dc, err
+	}
+	if dc.KeepAliveInterval, err = s.Seconds("keep_alive_interval", 20*time.Second); err != nil {
+		return dc, err
+	}
+	return dc, nil
+}
+
+// udpServerAddr turns "http://10.10.10.9:801" or "10.10.10.9" into
+// "10.10.10.9:61440"; an explicit host:port is kept.
+func udpServerAddr(host string) string {
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil {
+			return net.JoinHostPort(u.Hostname(), defaultUDPPort)
+		}
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, defaultUDPPort)
+}
+
+// DClient speaks the D-version protocol: challenge (0x01/0x02),
+// login (0x03/0x04), logout (0x06) and keep-alive (0xff and 0x07).
+type DClient struct {
+	cfg DConfig
+	udp udpSession
+
+	mu       sync.Mutex
+	salt     []byte
+	authInfo []byte // 16-byte tail of the login response, echoed in keep-alives
+	since    time.Time
+}
+
+func NewDClient(cfg DConfig) *DClient {
+	return &DClient{
+		cfg: cfg,
+		udp: udpSession{
+			server:  cfg.Server,
+			iface:   cfg.Interface,
+			localIP: cfg.HostIP,
+			timeout: cfg.Timeout,
+		},
+	}
+}
+
+// dial opens the socket and fills in HostIP and MAC from it when unset.
+func (d *DClient) dial() error {
+	if _, err := d.udp.dial(); err != nil {
+		return err
+	}
+	if d.cfg.HostIP == nil {
+		d.cfg.HostIP = d.udp.local()
+	}
+	if d.cfg.MAC == nil {
+		d.cfg.MAC = macForIP(d.cfg.HostIP)
+	}
+	return nil
+}
+
+func (d *DClient) challenge(ctx context.Context) ([]byte, error) {
+	pkt := make([]byte, 20)
+	pkt[0], pkt[1] = 0x01, 0x02
+	binary.LittleEndian.PutUint16(pkt[2:4], uint16(rand.Intn(0xffff)))
+	pkt[4] = 0x09
+	if err := d.dial(); err != nil {
+		return nil, err
+	}
+	resp, err := d.udp.exchange(ctx, pkt, func(b []byte) bool { return len(b) >= 8 && b[0] == 0x02 })
+	if err != nil {
+		return nil, err
+	}
+	return resp[4:8], nil
+}
+
+func (d *DClient) Login(ctx context.Context) (*LoginResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	salt, err := d.challenge(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pkt := d.loginPacket(salt)
+	resp, err := d.udp.exchange(ctx, pkt, func(b []byte) bool {
+		return len(b) > 0 && (b[0] == 0x04 || b[0] == 0x05)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp[0] == 0x05 {
+		code := byte(0)
+		if len(resp) > 4 {
+			code = resp[4]
+		}
+		outcome, msg := dLoginError(code)
+		return &LoginResult{Outcome: outcome, Message: msg, Code: fmt.Sprintf("0x%02x", code), Raw: resp}, nil
+	}
+	if len(resp) < 39 {
+		return nil, fmt.Errorf("short login response (%d bytes)", len(resp))
+	}
+	d.salt = salt
+	d.authInfo = resp[23:39]
+	d.since = time.Now()
+	return &LoginResult{Outcome: OutcomeSuccess, Message: "登录成功", Raw: resp}, nil
+}
+
+// dLoginError maps the error byte of a 0x05 login reply.
+func dLoginError(code byte) (LoginOutcome, string) {
+	switch code {
+	case 0x01:
+		return OutcomeAlreadyOnline, "账号正在使用"
+	case 0x03:
+		return OutcomeWrongPassword, "账号或密码错误"
+	case 0x04:
+		return OutcomeAccountArrears, "账号余额不足"
+	case 0x05:
+		return OutcomeAccountDisabled, "账号已暂停使用"
+	case 0x07:
+		return OutcomePortalError, "IP 地址不匹配"
+	case 0x0b:
+		return OutcomePortalError, "MAC 地址不匹配"
+	case 0x14:
+		return OutcomeTooManyDevices, "在线终端数已满"
+	case 0x15:
+		return OutcomePortalError, "客户端版本不符"
+	default:
+		return OutcomeUnknown, fmt.Sprintf("未知错误码 0x%02x", code)
+	}
+}
+
+func (d *DClient) loginPacket(salt []byte) []byte {
+	c := d.cfg
+	usr := []byte(c.Username)
+	pwd := []byte(c.Password)
+	var b bytes.Buffer
+
+	b.Write([]byte{0x03, 0x01, 0x00, byte(len(usr) + 20)})
+	md5a := md5sum([]byte{0x03, 0x01}, salt, pwd)
+	b.Write(md5a)
+	b.Write(padTo(usr, 36))
+	b.WriteByte(c.ControlCheckStatus)
+	b.WriteByte(c.AdapterNum)
+	b.Write(xorMAC(md5a[:6], c.MAC))
+	b.Write(md5sum([]byte{0x01}, pwd, salt, make([]byte, 4)))
+	b.WriteByte(0x01) // number of IPs
+	b.Write(ip4(c.HostIP))
+	b.Write(make([]byte, 12)) // IP addresses 2-4
+	b.Write(md5sum(b.Bytes(), []byte{0x14, 0x00, 0x07, 0x0b})[:8])
+	b.WriteByte(c.IPDog)
+	b.Write(make([]byte, 4))
+	b.Write(padTo([]byte(c.HostName), 32))
+	b.Write(ip4(c.PrimaryDNS))
+	b.Write(ip4(c.DHCPServer))
+	b.Write(make([]byte, 4)) // secondary DNS
+	b.Write(make([]byte, 8))
+	b.Write([]byte{0x94, 0x00, 0x00, 0x00})
+	b.Write([]byte{0x05, 0x00, 0x00, 0x00}) // OS major
+	b.Write([]byte{0x01, 0x00, 0x00, 0x00}) // OS minor
+	b.Write([]byte{0x28, 0x0a, 0x00, 0x00}) // OS build
+	b.Write([]byte{0x02, 0x00, 0x00, 0x00})
+	b.Write(padTo([]byte(c.HostOS), 32))
+	b.Write(make([]byte, 96))
+	b.Write(c.AuthVersion)
+	b.Write([]byte{0x02, 0x0c})
+	mac := macBytes(c.MAC)
+	sum := dChecksum(append(append(append([]byte(nil), b.Bytes()...), 0x01, 0x26, 0x07, 0x11, 0x00, 0x00), mac...))
+	b.Write(sum)
+	b.Write([]byte{0x00, 0x00})
+	b.Write(mac)
+	b.WriteByte(0x00) // auto logout
+	b.WriteByte(0x00) // broadcast mode
+	b.Write([]byte{0xe9, 0x13})
+	return b.Bytes()
+}
+
+func (d *DClient) Logout(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.udp.close()
+
+	if d.authInfo == nil {
+		return ErrNotLocalSession
+	}
+	salt, err := d.challenge(ctx)
+	if err != nil {
+		return err
+	}
+	usr := []byte(d.cfg.Username)
+	var b bytes.Buffer
+	b.Write([]byte{0x06, 0x01, 0x00, byte(len(usr) + 20)})
+	md5a := md5sum([]byte{0x06, 0x01}, salt, []byte(d.cfg.Password))
+	b.Write(md5a)
+	b.Write(padTo(usr, 36))
+	b.WriteByte(d.cfg.ControlCheckStatus)
+	b.WriteByte(d.cfg.AdapterNum)
+	b.Write(xorMAC(md5a[:6], d.cfg.MAC))
+	b.Write(d.authInfo)
+	_, err = d.udp.conn.Write(b.Bytes())
+	d.authInfo = nil
+	return err
+}
+
+// Status reports the session of this process; the UDP protocol has no
+// usage query.
+func (d *DClient) Status(ctx context.Context) (*AccountStatus, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st := &AccountStatus{
+		Username: d.cfg.Username,
+		Host:     d.cfg.Server,
+		LoggedIn: d.authInfo != nil,
+	}
+	if d.cfg.HostIP != nil {
+		st.IP = d.cfg.HostIP.String()
+	}
+	if !st.LoggedIn {
+		return st, fmt.Errorf("%w: %w", ErrNoStatusData, ErrNotLocalSession)
+	}
+	st.OnlineSeconds = int64(time.Since(d.since).Seconds())
+	return st, nil
+}
+
+// Probe performs a challenge round-trip.
+func (d *DClient) Probe(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err := d.challenge(ctx)
+	return err
+}
+
+// KeepAlive runs the heartbeat: a 0xff packet followed by a pair of 0x07
+// packets (type 1 and type 3) every KeepAliveInterval.
+func (d *DClient) KeepAlive(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.authInfo == nil {
+		return ErrNoSession
+	}
+
+	var num byte
+	tail := make([]byte, 4)
+	isReply := func(b []byte) bool { return len(b) >= 20 && b[0] == 0x07 }
+
+	// Handshake: a "first" type-1 packet, then one type-1/type-3 pair.
+	resp, err := d.udp.exchange(ctx, keepAlive2Packet(num, tail, 1, true, d.cfg.KeepAliveVersion, d.cfg.HostIP), func(b []byte) bool { return len(b) > 2 && b[0] == 0x07 })
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSessionLost, err)
+	}
+	if resp[2] == 0x10 {
+		num++
+	}
+	for _, typ := range []byte{1, 3} {
+		resp, err := d.udp.exchange(ctx, keepAlive2Packet(num, tail, typ, false, d.cfg.KeepAliveVersion, d.cfg.HostIP), isReply)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrSessionLost, err)
+		}
+		copy(tail, resp[16:20])
+	}
+	num++
+
+	for {
+		if _, err := d.udp.exchange(ctx, d.keepAlive1Packet(), isReply); err != nil {
+			return fmt.Errorf("%w: %v", ErrSessionLost, err)
+		}
+		for _, typ := range []byte{1, 3} {
+			resp, err := d.udp.exchange(ctx, keepAlive2Packet(num, tail, typ, false, d.cfg.KeepAliveVersion, d.cfg.HostIP), isReply)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrSessionLost, err)
+			}
+			copy(tail, resp[16:20])
+			num++
+		}
+
+		d.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			d.mu.Lock()
+			return ctx.Err()
+		case <-time.After(d.cfg.KeepAliveInterval):
+		}
+		d.mu.Lock()
+		if d.authInfo == nil {
+			return ErrSessionLost
+		}
+	}
+}
+
+func (d *DClient) keepAlive1Packet() []byte {
+	var b bytes.Buffer
+	b.WriteByte(0xff)
+	b.Write(md5sum([]byte{0x03, 0x01}, d.salt, []byte(d.cfg.Password)))
+	b.Write(make([]byte, 3))
+	b.Write(d.authInfo)
+	binary.Write(&b, binary.BigEndian, uint16(time.Now().Unix()%0xffff))
+	b.Write(make([]byte, 4))
+	return b.Bytes()
+}
+
+// keepAlive2Packet builds the 40-byte 0x07 keep-alive shared by the D and
+// P versions; type 3 packets carry the host IP.
+func keepAlive2Packet(num byte, tail []byte, typ byte, first bool, version []byte, hostIP net.IP) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0x07, num, 0x28, 0x00, 0x0b, typ})
+	if first {
+		b.Write([]byte{0x0f, 0x27})
+	} else {
+		b.Write(version)
+	}
+	b.Write([]byte{0x2f, 0x12})
+	b.Write(make([]byte, 6))
+	b.Write(tail)
+	b.Write(make([]byte, 4))
+	if typ == 3 {
+		b.Write(make([]byte, 4)) // CRC, accepted as zero by the servers seen so far
+		b.Write(ip4(hostIP))
+		b.Write(make([]byte, 8))
+	} else {
+		b.Write(make([]byte, 16))
+	}
+	return b.Bytes()
+}
+
+// dChecksum is the login packet checksum: XOR of little-endian uint32
+// words (a trailing partial word is ignored) seeded with 1234, times 1968.
+func dChecksum(data []byte) []byte {
+	sum := uint32(1234)
+	for i := 0; i+4 <= len(data); i += 4 {
+		sum ^= binary.LittleEndian.Uint32(data[i : i+4])
+	}
+	sum *= 1968
+	out := make([]byte, 4)
+	binary.LittleEndian.PutUint32(out, sum)
+	return out
+}
+
+func xorMAC(b []byte, mac net.HardwareAddr) []byte {
+	m := macBytes(mac)
+	out := make([]byte, 6)
+	for i := range out {
+		out[i] = b[i] ^ m[i]
+	}
+	return out
+}
@@ -0,0 +1,350 @@
+package drcom
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// dServer is a stand-in D-version server that checks every packet against
+// the drcom-generic layouts and answers like a real one.
+type dServer struct {
+	t    *testing.T
+	conn *net.UDPConn
+
+	username, password string
+	mac                net.HardwareAddr
+	hostIP             net.IP
+	salt               []byte
+	authInfo           []byte
+	loginCode          byte // 0 accepts the login, otherwise sent in a 0x05 reply
+
+	tail      []byte // Tail handed out with the last 0x07 reply
+	keepAlive chan []byte
+	logout    chan []byte
+}
+
+// newDServer starts a server; a non-zero loginCode rejects logins with it.
+func newDServer(t *testing.T, loginCode byte) *dServer {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dServer{
+		t:         t,
+		conn:      conn,
+		username:  "student",
+		password:  "secret",
+		mac:       net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		hostIP:    net.IPv4(127, 0, 0, 1).To4(),
+		salt:      []byte{0xde, 0xad, 0xbe, 0xef},
+		authInfo:  []byte("0123456789abcdef"),
+		loginCode: loginCode,
+		tail:      make([]byte, 4),
+		keepAlive: make(chan []byte, 64),
+		logout:    make(chan []byte, 1),
+	}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *dServer) client() *DClient {
+	return NewDClient(DConfig{
+		Server:             s.conn.LocalAddr().String(),
+		Username:           s.username,
+		Password:           s.password,
+		HostName:           "lab-pc",
+		HostOS:             "Windows 10",
+		HostIP:             s.hostIP,
+		MAC:                s.mac,
+		AuthVersion:        []byte{0x0a, 0x00},
+		KeepAliveVersion:   []byte{0xdc, 0x02},
+		ControlCheckStatus: 0x20,
+		AdapterNum:         0x01,
+		IPDog:              0x01,
+		KeepAliveInterval:  10 * time.Millisecond,
+		Timeout:            time.Second,
+	})
+}
+
+func (s *dServer) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		pkt := append([]byte(nil), buf[:n]...)
+		var reply []byte
+		switch pkt[0] {
+		case 0x01:
+			reply = s.challenge(pkt)
+		case 0x03:
+			reply = s.login(pkt)
+		case 0x06:
+			s.checkAuth("logout", pkt, 0x06)
+			s.logout <- pkt
+		case 0xff:
+			reply = s.keepAlive1(pkt)
+		case 0x07:
+			reply = s.keepAlive2(pkt)
+		default:
+			s.t.Errorf("unexpected packet type 0x%02x", pkt[0])
+		}
+		if reply != nil {
+			s.conn.WriteToUDP(reply, addr)
+		}
+	}
+}
+
+func (s *dServer) challenge(pkt []byte) []byte {
+	if len(pkt) != 20 || pkt[1] != 0x02 || pkt[4] != 0x09 {
+		s.t.Errorf("challenge: bad packet % x", pkt)
+	}
+	reply := make([]byte, 76)
+	reply[0], reply[1] = 0x02, 0x02
+	copy(reply[2:4], pkt[2:4])
+	copy(reply[4:8], s.salt)
+	return reply
+}
+
+// checkAuth verifies the header shared by login and logout: code, MD5A,
+// padded username, control/adapter bytes and MD5A xor MAC.
+func (s *dServer) checkAuth(what string, pkt []byte, code byte) {
+	if len(pkt) < 64 {
+		s.t.Errorf("%s: short packet (%d bytes)", what, len(pkt))
+		return
+	}
+	if pkt[0] != code || pkt[1] != 0x01 || pkt[2] != 0x00 || int(pkt[3]) != len(s.username)+20 {
+		s.t.Errorf("%s: bad header % x", what, pkt[:4])
+	}
+	md5a := md5.Sum(append(append([]byte{code, 0x01}, s.salt...), s.password...))
+	if !bytes.Equal(pkt[4:20], md5a[:]) {
+		s.t.Errorf("%s: MD5A mismatch", what)
+	}
+	if user := string(bytes.TrimRight(pkt[20:56], "\x00")); user != s.username {
+		s.t.Errorf("%s: username %q", what, user)
+	}
+	if pkt[56] != 0x20 || pkt[57] != 0x01 {
+		s.t.Errorf("%s: control check/adapter % x", what, pkt[56:58])
+	}
+	for i := 0; i < 6; i++ {
+		if pkt[58+i] != md5a[i]^s.mac[i] {
+			s.t.Errorf("%s: MAC xor MD5A mismatch at byte %d", what, i)
+			break
+		}
+	}
+	if code == 0x06 && !bytes.Equal(pkt[64:80], s.authInfo) {
+		s.t.Errorf("logout: auth info % x, want % x", pkt[64:80], s.authInfo)
+	}
+}
+
+// login checks the 330-byte login packet field by field.
+func (s *dServer) login(pkt []byte) []byte {
+	s.checkAuth("login", pkt, 0x03)
+	if len(pkt) != 330 {
+		s.t.Errorf("login: %d bytes, want 330", len(pkt))
+		return nil
+	}
+	md5b := md5.Sum(append(append(append([]byte{0x01}, s.password...), s.salt...), 0, 0, 0, 0))
+	if !bytes.Equal(pkt[64:80], md5b[:]) {
+		s.t.Errorf("login: MD5B mismatch")
+	}
+	if pkt[80] != 0x01 || !bytes.Equal(pkt[81:85], s.hostIP) {
+		s.t.Errorf("login: IP list % x", pkt[80:85])
+	}
+	md5c := md5.Sum(append(append([]byte(nil), pkt[:97]...), 0x14, 0x00, 0x07, 0x0b))
+	if !bytes.Equal(pkt[97:105], md5c[:8]) {
+		s.t.Errorf("login: MD5C mismatch")
+	}
+	if pkt[105] != 0x01 {
+		s.t.Errorf("login: ip_dog 0x%02x", pkt[105])
+	}
+	if host := string(bytes.TrimRight(pkt[110:142], "\x00")); host != "lab-pc" {
+		s.t.Errorf("login: host name %q", host)
+	}
+	if !bytes.Equal(pkt[310:314], []byte{0x0a, 0x00, 0x02, 0x0c}) {
+		s.t.Errorf("login: auth version % x", pkt[310:314])
+	}
+	// drcom-generic: checksum(data + '\x01\x26\x07\x11\x00\x00' + mac)
+	sumInput := append(append(append([]byte(nil), pkt[:314]...), 0x01, 0x26, 0x07, 0x11, 0x00, 0x00), s.mac...)
+	sum := uint32(1234)
+	for i := 0; i+4 <= len(sumInput); i += 4 {
+		sum ^= binary.LittleEndian.Uint32(sumInput[i:])
+	}
+	sum *= 1968
+	if got := binary.LittleEndian.Uint32(pkt[314:318]); got != sum {
+		s.t.Errorf("login: checksum %08x, want %08x", got, sum)
+	}
+	if !bytes.Equal(pkt[320:326], s.mac) || !bytes.Equal(pkt[328:330], []byte{0xe9, 0x13}) {
+		s.t.Errorf("login: trailer % x", pkt[318:330])
+	}
+
+	if s.loginCode != 0 {
+		return []byte{0x05, 0x00, 0x00, 0x05, s.loginCode, 0x00}
+	}
+	reply := make([]byte, 45)
+	reply[0] = 0x04
+	copy(reply[23:39], s.authInfo)
+	return reply
+}
+
+func (s *dServer) keepAlive1(pkt []byte) []byte {
+	want := md5.Sum(append(append([]byte{0x03, 0x01}, s.salt...), s.password...))
+	if len(pkt) != 42 || !bytes.Equal(pkt[1:17], want[:]) || !bytes.Equal(pkt[20:36], s.authInfo) {
+		s.t.Errorf("keep-alive 0xff: bad packet % x", pkt)
+	}
+	s.keepAlive <- pkt
+	reply := make([]byte, 40)
+	reply[0] = 0x07
+	return reply
+}
+
+// keepAlive2 checks a 40-byte 0x07/0x28 packet: the tail must be the one
+// handed out with the previous reply, and type 3 carries the host IP.
+func (s *dServer) keepAlive2(pkt []byte) []byte {
+	if len(pkt) != 40 || pkt[2] != 0x28 || pkt[3] != 0x00 || pkt[4] != 0x0b {
+		s.t.Errorf("keep-alive 0x07: bad header % x", pkt)
+		return nil
+	}
+	first := bytes.Equal(pkt[6:8], []byte{0x0f, 0x27})
+	if !first && !bytes.Equal(pkt[6:8], []byte{0xdc, 0x02}) {
+		s.t.Errorf("keep-alive 0x07: version % x", pkt[6:8])
+	}
+	if !bytes.Equal(pkt[8:10], []byte{0x2f, 0x12}) {
+		s.t.Errorf("keep-alive 0x07: bytes 8-9 % x", pkt[8:10])
+	}
+	if !first && !bytes.Equal(pkt[16:20], s.tail) {
+		s.t.Errorf("keep-alive 0x07: tail % x, want % x", pkt[16:20], s.tail)
+	}
+	if pkt[5] == 3 && !bytes.Equal(pkt[28:32], s.hostIP) {
+		s.t.Errorf("keep-alive 0x07 type 3: host IP % x", pkt[28:32])
+	}
+	s.keepAlive <- pkt
+
+	reply := make([]byte, 40)
+	reply[0], reply[1], reply[2] = 0x07, pkt[1], 0x28
+	if first {
+		reply[2] = 0x10
+		return reply
+	}
+	s.tail = []byte{pkt[1], pkt[5], 0x5a, 0xa5}
+	copy(reply[16:20], s.tail)
+	return reply
+}
+
+func TestDClientSession(t *testing.T) {
+	s := newDServer(t, 0)
+	d := s.client()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := d.Login(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Outcome != OutcomeSuccess {
+		t.Fatalf("outcome %v", res.Outcome)
+	}
+	if st, err := d.Status(ctx); err != nil || !st.LoggedIn {
+		t.Fatalf("status %+v, %v", st, err)
+	}
+
+	kaCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- d.KeepAlive(kaCtx) }()
+
+	// Handshake (first, 1, 3), then two rounds of 0xff, 1, 3.
+	var seq []string
+	for len(seq) < 9 {
+		select {
+		case pkt := <-s.keepAlive:
+			if pkt[0] == 0xff {
+				seq = append(seq, "ff")
+			} else {
+				seq = append(seq, fmt.Sprintf("07/%d/%d", pkt[1], pkt[5]))
+			}
+		case err := <-done:
+			t.Fatalf("keep-alive stopped early: %v", err)
+		case <-ctx.Done():
+			t.Fatalf("keep-alive sequence %v incomplete", seq)
+		}
+	}
+	stop()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("keep-alive returned %v", err)
+	}
+	// The 0x10 reply to the first packet bumps the number to 1.
+	want := []string{"07/0/1", "07/1/1", "07/1/3", "ff", "07/2/1", "07/3/3", "ff", "07/4/1", "07/5/3"}
+	if fmt.Sprint(seq) != fmt.Sprint(want) {
+		t.Fatalf("keep-alive sequence %v, want %v", seq, want)
+	}
+
+	if err := d.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-s.logout:
+	case <-ctx.Done():
+		t.Fatal("no logout packet")
+	}
+	if _, err := d.Status(ctx); !errors.Is(err, ErrNoStatusData) {
+		t.Fatalf("status after logout: %v", err)
+	}
+}
+
+// TestNotLocalSession covers drcom status and logout run next to the
+// daemon: a fresh UDP client knows nothing of the daemon's session.
+func TestNotLocalSession(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ds := newDServer(t, 0)
+	drivers := map[string]PortalDriver{"drcom-d": ds.client(), "drcom-p": newPServer(t).client()}
+	for name, d := range drivers {
+		_, err := d.Status(ctx)
+		// The daemon's probe still reads this as "no session".
+		if !errors.Is(err, ErrNotLocalSession) || !errors.Is(err, ErrNoStatusData) {
+			t.Errorf("%s status: %v", name, err)
+		}
+		if err := d.Logout(ctx); !errors.Is(err, ErrNotLocalSession) {
+			t.Errorf("%s logout: %v", name, err)
+		}
+	}
+	select {
+	case <-ds.logout:
+		t.Fatal("logout packet sent without a session")
+	default:
+	}
+}
+
+func TestDClientLoginErrors(t *testing.T) {
+	tests := []struct {
+		code byte
+		want LoginOutcome
+	}{
+		{0x01, OutcomeAlreadyOnline},
+		{0x03, OutcomeWrongPassword},
+		{0x04, OutcomeAccountArrears},
+		{0x05, OutcomeAccountDisabled},
+		{0x14, OutcomeTooManyDevices},
+		{0x42, OutcomeUnknown},
+	}
+	for _, tt := range tests {
+		s := newDServer(t, tt.code)
+		res, err := s.client().Login(context.Background())
+		if err != nil {
+			t.Fatalf("code 0x%02x: %v", tt.code, err)
+		}
+		if res.Outcome != tt.want || res.Code != fmt.Sprintf("0x%02x", tt.code) {
+			t.Errorf("code 0x%02x: outcome %v (%s), want %v", tt.code, res.Outcome, res.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package drcom
+
+import "context"
+
+// DriverEPortal is the Dr.COM ePortal JSONP flow implemented by DrComClient.
+const DriverEPortal = "eportal"
+
+func init() {
+	RegisterDriver(DriverEPortal, func(cfg DriverConfig) (PortalDriver, error) {
+		return NewEPortalDriver(NewClient(cfg.Host, cfg.Username, cfg.Password, cfg.Options...)), nil
+	})
+}
+
+// EPortalDriver adapts DrComClient to the PortalDriver interface.
+type EPortalDriver struct {
+	Client *DrComClient
+}
+
+func NewEPortalDriver(c *DrComClient) *EPortalDriver {
+	return &EPortalDriver{Client: c}
+}
+
+func (d *EPortalDriver) Login(ctx context.Context) (*LoginResult, error) {
+	resp, err := d.Client.LoginContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{
+		Outcome: d.Client.Classify(resp),
+		Message: resp.Msg,
+		Code:    anyString(resp.RetCode),
+		Raw:     resp,
+	}, nil
+}
+
+func (d *EPortalDriver) Logout(ctx context.Context) error {
+	return d.Client.LogoutContext(ctx)
+}
+
+func (d *EPortalDriver) Status(ctx context.Context) (*AccountStatus, error) {
+	return d.Client.AccountStatus(ctx)
+}
+
+// Probe fetches the portal root; any HTTP answer counts as reachable. It
+// goes through the host pool, so it also updates host health.
+func (d *EPortalDriver) Probe(ctx context.Context) error {
+	_, err := d.Client.doRequest(ctx, d.Client.host()+"/")
+	return err
+}
+
+func (d *EPortalDriver) Hosts() []HostHealth {
+	return d.Client.Hosts()
+}
+
+func (d *EPortalDriver) AddressChange() *AddressChange {
+	return d.Client.AddressChange()
+}
+
+func (d *EPortalDriver) Handover(ctx context.Context, ch *AddressChange) error {
+	return handover(ctx, d, d.Client, ch)
+}
@@ -0,0 +1,146 @@
+package drcom
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Password encryption schemes seen in portal scripts. EncryptAuto
+// fingerprints the portal before the first login.
+const (
+	EncryptNone = "none"
+	EncryptMD5  = "md5"
+	EncryptRSA  = "rsa"
+	EncryptAuto = "auto"
+)
+
+// maxScripts bounds the scripts fetched while fingerprinting.
+const maxScripts = 12
+
+var (
+	scriptSrcRe     = regexp.MustCompile(`(?i)<script[^>]+src=["']([^"']+)["']`)
+	jsVersionRe     = regexp.MustCompile(`jsVersion["']?\s*[:=]\s*["']?(\d+(?:\.\d+)+)`)
+	loginMethodRe   = regexp.MustCompile(`login_method["']?\s*[:=]\s*["']?(\d+)`)
+	terminalTypeRe  = regexp.MustCompile(`terminal_type["']?\s*[:=]\s*["']?(\d+)`)
+	accountPrefixRe = regexp.MustCompile(`["'](,[` + "`" + `\d],)["']\s*\+`)
+	rsaKeyPairRe    = regexp.MustCompile(`(?:RSAKeyPair|setPublic)\(\s*["']([0-9a-fA-F]+)["']\s*,\s*["']([0-9a-fA-F]*)["']\s*(?:,\s*["']([0-9a-fA-F]+)["'])?`)
+	pemKeyRe        = regexp.MustCompile(`-----BEGIN PUBLIC KEY-----[A-Za-z0-9+/=\s\\n]+-----END PUBLIC KEY-----`)
+	base64KeyRe     = regexp.MustCompile(`(?i)public_?key["']?\s*[:=]\s*["'](MI[A-Za-z0-9+/=]{100,})["']`)
+	encryptFlagRe   = regexp.MustCompile(`(?i)\b(?:enPwd|encrypt|pwdEncrypt)["']?\s*[:=]\s*["']?1`)
+	md5PasswordRe   = regexp.MustCompile(`(?i)(?:hex_md5|md5)\s*\([^)]*(?:pass|pwd)`)
+)
+
+// Fingerprint is what the portal's landing page and scripts reveal.
+type Fingerprint struct {
+	Driver     string // Suggested driver name
+	Version    string // jsVersion, if found
+	Encryption string // EncryptNone, EncryptMD5 or EncryptRSA
+
+	// RSA key material, either as exponent/modulus hex or a PEM/base64 key.
+	RSAExponent string
+	RSAModulus  string
+	PublicKey   string
+
+	Profile Profile  // Request shape for the eportal driver
+	Scripts []string // Scripts that were inspected
+}
+
+// FingerprintPortal fetches the landing page at host and its scripts and
+// identifies the portal type, jsVersion and password encryption.
+func FingerprintPortal(ctx context.Context, host string, opts ...Option) (*Fingerprint, error) {
+	return NewClient(host, "", "", opts...).fingerprint(ctx)
+}
+
+// fingerprint inspects the portal through c, so requests fail over between
+// its hosts like any other.
+func (c *DrComClient) fingerprint(ctx context.Context) (*Fingerprint, error) {
+	body, err := c.doRequest(ctx, c.host()+"/")
+	if err != nil {
+		return nil, err
+	}
+	// Scripts are fetched from the host that answered.
+	page, err := url.Parse(c.host() + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	fp := &Fingerprint{}
+	sources := []string{body}
+	for _, m := range scriptSrcRe.FindAllStringSubmatch(body, -1) {
+		if len(fp.Scripts) == maxScripts {
+			break
+		}
+		u, err := page.Parse(m[1])
+		if err != nil || u.Hostname() != page.Hostname() {
+			continue // CDN libraries tell us nothing about the portal
+		}
+		js, err := c.doRequest(ctx, u.String())
+		if err != nil {
+			c.logger.Printf("fetching %s: %v", u, err)
+			continue
+		}
+		fp.Scripts = append(fp.Scripts, u.String())
+		sources = append(sources, js)
+	}
+	fp.analyze(strings.Join(sources, "\n"))
+	if fp.Driver == "" {
+		return fp, fmt.Errorf("unrecognized portal at %s", c.host())
+	}
+	return fp, nil
+}
+
+// analyze fills fp from the concatenated page and script sources.
+func (fp *Fingerprint) analyze(src string) {
+	switch {
+	case strings.Contains(src, "eportal/portal/login") || strings.Contains(src, "wlan_user_ip"):
+		fp.Driver = DriverEPortal
+	case strings.Contains(src, "srun_portal") || strings.Contains(src, "get_challenge"):
+		fp.Driver = DriverSrun
+	case strings.Contains(src, "InterFace.do"):
+		fp.Driver = DriverRuijie
+	case strings.Contains(src, "DDDDD") || strings.Contains(src, "0MKKey"):
+		fp.Driver = DriverWeb
+	}
+
+	fp.Encryption = EncryptNone
+	if m := rsaKeyPairRe.FindStringSubmatch(src); m != nil {
+		fp.Encryption = EncryptRSA
+		fp.RSAExponent = m[1]
+		// RSAKeyPair(e, d, n) vs setPublic(n, e).
+		if m[3] != "" {
+			fp.RSAModulus = m[3]
+		} else {
+			fp.RSAModulus, fp.RSAExponent = m[1], m[2]
+		}
+	} else if m := pemKeyRe.FindString(src); m != "" {
+		fp.Encryption = EncryptRSA
+		fp.PublicKey = strings.ReplaceAll(m, `\n`, "\n")
+	} else if m := base64KeyRe.FindStringSubmatch(src); m != nil {
+		fp.Encryption = EncryptRSA
+		fp.PublicKey = m[1]
+	} else if md5PasswordRe.MatchString(src) || encryptFlagRe.MatchString(src) {
+		fp.Encryption = EncryptMD5
+	}
+
+	p := DefaultProfile
+	p.Name = "detected"
+	if m := jsVersionRe.FindStringSubmatch(src); m != nil {
+		fp.Version = m[1]
+		p.JSVersion = m[1]
+	}
+	if m := loginMethodRe.FindStringSubmatch(src); m != nil {
+		p.LoginMethod = m[1]
+	}
+	if m := terminalTypeRe.FindStringSubmatch(src); m != nil {
+		p.TerminalType = m[1]
+	}
+	if m := accountPrefixRe.FindStringSubmatch(src); m != nil {
+		p.AccountTemplate = m[1] + "{account}"
+	}
+	p.Encryption = fp.Encryption
+	p.RSAModulus, p.RSAExponent, p.PublicKey = fp.RSAModulus, fp.RSAExponent, fp.PublicKey
+	fp.Profile = p
+}
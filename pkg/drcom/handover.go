@@ -0,0 +1,111 @@
+package drcom
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AddressChange is a change of the local address a session is bound to,
+// e.g. after a DHCP renewal handed out a new lease.
+type AddressChange struct {
+	Type        string    `json:"type"` // Always "address_change", for the event log
+	Time        time.Time `json:"time"`
+	Interface   string    `json:"interface,omitempty"`
+	OldIP       string    `json:"old_ip,omitempty"`
+	NewIP       string    `json:"new_ip,omitempty"`
+	OldIPv6     string    `json:"old_ipv6,omitempty"`
+	NewIPv6     string    `json:"new_ipv6,omitempty"`
+	LogoutError string    `json:"logout_error,omitempty"`
+}
+
+// AddressWatcher is implemented by drivers whose requests carry the local
+// address, which they cache.
+type AddressWatcher interface {
+	// AddressChange re-detects the local addresses; nil if unchanged.
+	AddressChange() *AddressChange
+	// Handover logs out the session of the old address where possible and
+	// switches to the new one. The next Login authenticates the new address
+	// even if the logout failed, which is reported as the error.
+	Handover(ctx context.Context, ch *AddressChange) error
+}
+
+// AddressChange compares the addresses in use with freshly detected ones.
+// Pinned addresses and addresses that were never used are not checked.
+func (c *DrComClient) AddressChange() *AddressChange {
+	c.mu.Lock()
+	oldIP, oldIPv6 := c.IP, c.IPv6
+	c.mu.Unlock()
+	if (oldIP == "" || c.pinnedIP) && (oldIPv6 == "" || c.pinnedIPv6) {
+		return nil
+	}
+	la, err := DetectLocalAddr(c.host(), c.iface)
+	if err != nil {
+		// No route at all is an outage, not an address change.
+		return nil
+	}
+	ch := &AddressChange{Type: "address_change", Time: c.now(), Interface: la.Interface}
+	changed := false
+	if oldIP != "" && !c.pinnedIP && la.IP.String() != oldIP {
+		ch.OldIP, ch.NewIP, changed = oldIP, la.IP.String(), true
+	}
+	if oldIPv6 != "" && !c.pinnedIPv6 {
+		ifname := c.iface
+		if ifname == "" {
+			ifname = la.Interface
+		}
+		if ip, err := detectIPv6(ifname); err == nil && ip.String() != oldIPv6 {
+			ch.OldIPv6, ch.NewIPv6, changed = oldIPv6, ip.String(), true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return ch
+}
+
+// resetAddress drops the cached addresses so they are detected again.
+func (c *DrComClient) resetAddress() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.local = nil
+	if !c.pinnedIP {
+		c.IP = ""
+	}
+	if !c.pinnedIPv6 {
+		c.IPv6 = ""
+	}
+}
+
+// handover logs out through d while the old addresses are still cached,
+// then clears them.
+func handover(ctx context.Context, d PortalDriver, c *DrComClient, ch *AddressChange) error {
+	err := d.Logout(ctx)
+	if err != nil {
+		ch.LogoutError = err.Error()
+	}
+	c.resetAddress()
+	return err
+}
+
+// RecordEvent appends ev as one JSON line to <dir>/events.jsonl.
+func RecordEvent(dir string, ev interface{}) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "events.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,104 @@
+package drcom
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// hostDownAfter consecutive failures mark a host down.
+	hostDownAfter = 2
+	// hostCooldown is how long a down host is skipped before it is tried
+	// first again, which gives automatic failback to the primary.
+	hostCooldown = time.Minute
+)
+
+// HostHealth is the observed health of one portal host.
+type HostHealth struct {
+	URL         string
+	Latency     time.Duration // Smoothed round-trip time of answered requests
+	Failures    int           // Consecutive failures
+	LastError   string
+	LastFailure time.Time
+	LastSuccess time.Time
+}
+
+// down reports whether h should be skipped in favour of healthier hosts.
+func (h *HostHealth) down(now time.Time) bool {
+	return h.Failures >= hostDownAfter && now.Sub(h.LastFailure) < hostCooldown
+}
+
+// hostPool keeps an ordered list of equivalent portal hosts, the first
+// being the primary.
+type hostPool struct {
+	mu    sync.Mutex
+	hosts []*HostHealth
+}
+
+func newHostPool(urls []string) *hostPool {
+	p := &hostPool{}
+	for _, u := range urls {
+		p.hosts = append(p.hosts, &HostHealth{URL: u})
+	}
+	return p
+}
+
+// order returns the hosts to try: those that are up in configured order,
+// then the down ones, least recently failed first.
+func (p *hostPool) order(now time.Time) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var up, down []*HostHealth
+	for _, h := range p.hosts {
+		if h.down(now) {
+			down = append(down, h)
+		} else {
+			up = append(up, h)
+		}
+	}
+	sort.SliceStable(down, func(i, j int) bool {
+		return down[i].LastFailure.Before(down[j].LastFailure)
+	})
+	urls := make([]string, 0, len(p.hosts))
+	for _, h := range append(up, down...) {
+		urls = append(urls, h.URL)
+	}
+	return urls
+}
+
+// report records the result of a request to url.
+func (p *hostPool) report(url string, now time.Time, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, h := range p.hosts {
+		if h.URL != url {
+			continue
+		}
+		if err != nil {
+			h.Failures++
+			h.LastError = err.Error()
+			h.LastFailure = now
+			return
+		}
+		h.Failures = 0
+		h.LastError = ""
+		h.LastSuccess = now
+		if h.Latency == 0 {
+			h.Latency = latency
+		} else {
+			h.Latency = (h.Latency*7 + latency*3) / 10
+		}
+		return
+	}
+}
+
+func (p *hostPool) snapshot() []HostHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]HostHealth, len(p.hosts))
+	for i, h := range p.hosts {
+		out[i] = *h
+	}
+	return out
+}
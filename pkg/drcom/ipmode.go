@@ -0,0 +1,103 @@
+package drcom
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// IPMode selects which address families are authenticated.
+type IPMode string
+
+const (
+	IPv4Only  IPMode = "v4"
+	IPv6Only  IPMode = "v6"
+	DualStack IPMode = "dual"
+)
+
+// ParseIPMode parses an ip_mode setting; empty means IPv4Only.
+func ParseIPMode(s string) (IPMode, error) {
+	switch m := IPMode(s); m {
+	case "":
+		return IPv4Only, nil
+	case IPv4Only, IPv6Only, DualStack:
+		return m, nil
+	}
+	return IPv4Only, fmt.Errorf("unknown ip mode %q (v4, v6 or dual)", s)
+}
+
+// V4 reports whether IPv4 is authenticated in this mode.
+func (m IPMode) V4() bool { return m != IPv6Only }
+
+// V6 reports whether IPv6 is authenticated in this mode.
+func (m IPMode) V6() bool { return m == IPv6Only || m == DualStack }
+
+// ipv6Anchor is only used to let the kernel pick an IPv6 source address;
+// nothing is sent to it.
+const ipv6Anchor = "[2400:3200::1]:53"
+
+var errNoIPv6 = errors.New("no global IPv6 address")
+
+// DetectLocalIPv6 returns a global IPv6 address of ifname, or, without an
+// interface, of the interface the kernel would use for the internet.
+// Unique local addresses (fc00::/7) are skipped, and stable addresses are
+// preferred to privacy and deprecated ones, which rotate.
+func DetectLocalIPv6(ifname string) (net.IP, error) {
+	var src net.IP
+	if ifname == "" {
+		conn, err := net.Dial("udp6", ipv6Anchor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errNoIPv6, err)
+		}
+		src = conn.LocalAddr().(*net.UDPAddr).IP
+		conn.Close()
+		if !src.IsGlobalUnicast() || src.IsPrivate() {
+			return nil, errNoIPv6
+		}
+	} else if _, err := net.InterfaceByName(ifname); err != nil {
+		return nil, err
+	}
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		if src != nil {
+			return src, nil
+		}
+		return nil, err
+	}
+	if src != nil {
+		for _, a := range addrs {
+			if a.ip.Equal(src) {
+				ifname = a.iface
+				break
+			}
+		}
+		if ifname == "" {
+			return src, nil
+		}
+	}
+	if ip := pickIPv6(addrs, ifname); ip != nil {
+		return ip, nil
+	}
+	if src != nil {
+		return src, nil
+	}
+	return nil, fmt.Errorf("%w on %s", errNoIPv6, ifname)
+}
+
+// pickIPv6 returns the first stable global IPv6 address of ifname, else
+// the first temporary one.
+func pickIPv6(addrs []ifAddr, ifname string) net.IP {
+	var fallback net.IP
+	for _, a := range addrs {
+		if a.iface != ifname || a.ip.To4() != nil || !a.ip.IsGlobalUnicast() || a.ip.IsPrivate() {
+			continue
+		}
+		if !a.temporary {
+			return a.ip
+		}
+		if fallback == nil {
+			fallback = a.ip
+		}
+	}
+	return fallback
+}
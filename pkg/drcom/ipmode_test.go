@@ -0,0 +1,27 @@
+package drcom
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPickIPv6(t *testing.T) {
+	a := func(iface, ip string, temporary bool) ifAddr {
+		return ifAddr{iface: iface, ip: net.ParseIP(ip), temporary: temporary}
+	}
+	tests := []struct {
+		name  string
+		addrs []ifAddr
+		want  string
+	}{
+		{"stable after privacy", []ifAddr{a("eth0", "2001:db8::a1b2", true), a("eth0", "2001:db8::2", false)}, "2001:db8::2"},
+		{"ULA skipped", []ifAddr{a("eth0", "fd12:3456::2", false), a("eth0", "2001:db8::a1b2", true)}, "2001:db8::a1b2"},
+		{"link-local and IPv4 skipped", []ifAddr{a("eth0", "fe80::2", false), a("eth0", "10.0.0.2", false)}, "<nil>"},
+		{"other interface", []ifAddr{a("wlan0", "2001:db8::2", false)}, "<nil>"},
+	}
+	for _, tt := range tests {
+		if got := pickIPv6(tt.addrs, "eth0").String(); got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package drcom
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// NetEventKind says what changed.
+type NetEventKind int
+
+const (
+	EventLink    NetEventKind = iota // Carrier, up/down, new or removed interface
+	EventAddress                     // Address added or removed (DHCP, SLAAC)
+	EventRoute                       // Routing table change (roaming, VPN)
+)
+
+func (k NetEventKind) String() string {
+	switch k {
+	case EventLink:
+		return "link"
+	case EventAddress:
+		return "address"
+	case EventRoute:
+		return "route"
+	}
+	return "unknown"
+}
+
+// NetEvent is one change notification from the kernel.
+type NetEvent struct {
+	Kind      NetEventKind
+	Interface string // Empty if unknown (e.g. routes, removed interfaces)
+	Time      time.Time
+
+	// Details, valid if Known
+	Known     bool
+	Up        bool   // EventLink: administratively up with carrier
+	Addr      net.IP // EventAddress: the address added or removed
+	Temporary bool   // EventAddress: IPv6 privacy, deprecated or tentative address
+	Removed   bool   // The link or address is gone
+}
+
+// EventSource delivers network change events until ctx is done, when the
+// channel is closed.
+type EventSource interface {
+	Events(ctx context.Context) (<-chan NetEvent, error)
+}
+
+// ErrEventsUnsupported is returned where no event source exists; callers
+// fall back to polling.
+var ErrEventsUnsupported = errors.New("network change events are not supported on this system")
+
+// FilterEvents passes events for ifname, plus events whose interface is
+// unknown. An empty ifname passes everything but loopback.
+func FilterEvents(in <-chan NetEvent, ifname string) <-chan NetEvent {
+	out := make(chan NetEvent)
+	go func() {
+		defer close(out)
+		for ev := range in {
+			if ev.Interface == "lo" || (ifname != "" && ev.Interface != "" && ev.Interface != ifname) {
+				continue
+			}
+			out <- ev
+		}
+	}()
+	return out
+}
+
+// Debounce batches bursts of events: a batch is sent once no event has
+// arrived for quiet, or at the latest after maxWait, so one cable replug
+// (link down, link up, address, routes) causes a single reaction.
+func Debounce(in <-chan NetEvent, quiet, maxWait time.Duration) <-chan []NetEvent {
+	out := make(chan []NetEvent)
+	go func() {
+		defer close(out)
+		var (
+			batch    []NetEvent
+			timer    <-chan time.Time
+			deadline <-chan time.Time
+		)
+		flush := func() {
+			out <- batch
+			batch, timer, deadline = nil, nil, nil
+		}
+		for {
+			select {
+			case ev, ok := <-in:
+				if !ok {
+					if len(batch) > 0 {
+						flush()
+					}
+					return
+				}
+				if batch == nil {
+					deadline = time.After(maxWait)
+				}
+				batch = append(batch, ev)
+				timer = time.After(quiet)
+			case <-timer:
+				flush()
+			case <-deadline:
+				flush()
+			}
+		}
+	}()
+	return out
+}
+
+// ifAddr is an interface address with the kernel's view of its lifetime.
+type ifAddr struct {
+	iface     string
+	ip        net.IP
+	temporary bool // IPv6 privacy, deprecated or tentative address
+}
+
+// stableAddr reports whether ip identifies the host towards the portal:
+// any IPv4 address, or a global IPv6 address that is neither unique local
+// (fc00::/7) nor temporary.
+func stableAddr(ip net.IP, temporary bool) bool {
+	if ip.IsLoopback() {
+		return false
+	}
+	if ip.To4() != nil {
+		return true
+	}
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !temporary
+}
+
+// ChangeTracker tells real link and address changes apart from repeated
+// notifications, such as RA lifetime refreshes, IPv6 privacy address
+// rotation or link attribute updates.
+type ChangeTracker struct {
+	up    map[string]bool
+	addrs map[string]bool // "iface/ip" of stable addresses
+}
+
+// NewChangeTracker starts from the current links and addresses.
+func NewChangeTracker() *ChangeTracker {
+	t := &ChangeTracker{up: map[string]bool{}, addrs: map[string]bool{}}
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		t.up[iface.Name] = iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagRunning != 0
+	}
+	addrs, _ := interfaceAddrs()
+	for _, a := range addrs {
+		if stableAddr(a.ip, a.temporary) {
+			t.addrs[a.iface+"/"+a.ip.String()] = true
+		}
+	}
+	return t
+}
+
+// Changed records ev and reports whether it brought a link up or down, or
+// added or removed a stable address. Events without details count as
+// changes unless they are route events.
+func (t *ChangeTracker) Changed(ev NetEvent) bool {
+	if !ev.Known || ev.Interface == "" {
+		return ev.Kind != EventRoute
+	}
+	switch ev.Kind {
+	case EventLink:
+		up := ev.Up && !ev.Removed
+		was := t.up[ev.Interface]
+		if ev.Removed {
+			delete(t.up, ev.Interface)
+		} else {
+			t.up[ev.Interface] = up
+		}
+		return was != up
+	case EventAddress:
+		key := ev.Interface + "/" + ev.Addr.String()
+		had := t.addrs[key]
+		if ev.Removed || !stableAddr(ev.Addr, ev.Temporary) {
+			delete(t.addrs, key)
+			return had
+		}
+		t.addrs[key] = true
+		return !had
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package drcom
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeSource replays events, sleeping for each step's delay first, and
+// closes the channel once done or when ctx ends.
+type fakeSource struct {
+	steps []fakeStep
+}
+
+type fakeStep struct {
+	delay time.Duration
+	ev    NetEvent
+}
+
+func (s fakeSource) Events(ctx context.Context) (<-chan NetEvent, error) {
+	ch := make(chan NetEvent)
+	go func() {
+		defer close(ch)
+		for _, st := range s.steps {
+			select {
+			case <-time.After(st.delay):
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case ch <- st.ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func ev(kind NetEventKind, ifname string) fakeStep {
+	return fakeStep{ev: NetEvent{Kind: kind, Interface: ifname}}
+}
+
+func after(d time.Duration, s fakeStep) fakeStep {
+	s.delay = d
+	return s
+}
+
+func eventNames(evs []NetEvent) string {
+	s := ""
+	for _, e := range evs {
+		s += fmt.Sprintf("%s:%s ", e.Kind, e.Interface)
+	}
+	return s
+}
+
+func TestFilterEvents(t *testing.T) {
+	steps := []fakeStep{
+		ev(EventLink, "eth0"),
+		ev(EventAddress, "lo"),
+		ev(EventAddress, "wlan0"),
+		ev(EventRoute, ""),
+		ev(EventAddress, "eth0"),
+	}
+	tests := []struct {
+		ifname string
+		want   string
+	}{
+		{"eth0", "link:eth0 route: address:eth0 "},
+		{"wlan0", "address:wlan0 route: "},
+		{"", "link:eth0 address:wlan0 route: address:eth0 "},
+		{"lo", "route: "},
+	}
+	for _, tt := range tests {
+		in, err := fakeSource{steps}.Events(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []NetEvent
+		for e := range FilterEvents(in, tt.ifname) {
+			got = append(got, e)
+		}
+		if eventNames(got) != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.ifname, eventNames(got), tt.want)
+		}
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	const (
+		quiet   = 50 * time.Millisecond
+		maxWait = 200 * time.Millisecond
+	)
+	tests := []struct {
+		name  string
+		steps []fakeStep
+		want  []string
+	}{
+		{
+			name: "burst coalesces",
+			steps: []fakeStep{
+				ev(EventLink, "eth0"),
+				after(5*time.Millisecond, ev(EventLink, "eth0")),
+				after(5*time.Millisecond, ev(EventAddress, "eth0")),
+				after(5*time.Millisecond, ev(EventRoute, "")),
+			},
+			want: []string{"link:eth0 link:eth0 address:eth0 route: "},
+		},
+		{
+			name: "quiet gap splits",
+			steps: []fakeStep{
+				ev(EventLink, "eth0"),
+				after(4*quiet, ev(EventAddress, "eth0")),
+			},
+			want: []string{"link:eth0 ", "address:eth0 "},
+		},
+		{
+			// Events every 30ms never leave a quiet gap, so maxWait flushes.
+			name: "max delay flushes",
+			steps: func() []fakeStep {
+				s := []fakeStep{ev(EventAddress, "eth0")}
+				for i := 0; i < 11; i++ {
+					s = append(s, after(30*time.Millisecond, ev(EventAddress, "eth0")))
+				}
+				return s
+			}(),
+			want: nil, // Checked by count below
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := fakeSource{tt.steps}.Events(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			total := 0
+			for batch := range Debounce(in, quiet, maxWait) {
+				got = append(got, eventNames(batch))
+				total += len(batch)
+			}
+			if total != len(tt.steps) {
+				t.Fatalf("%d events in batches %q, want %d", total, got, len(tt.steps))
+			}
+			if tt.want == nil {
+				// 12 events over ~330ms: the first batch is cut at maxWait,
+				// the rest flushes when the source closes.
+				if len(got) < 2 {
+					t.Fatalf("batches %q, want a flush at maxWait", got)
+				}
+				return
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("batches %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebounceClosedWithoutEvents(t *testing.T) {
+	in := make(chan NetEvent)
+	close(in)
+	for batch := range Debounce(in, time.Millisecond, time.Second) {
+		t.Fatalf("unexpected batch %v", batch)
+	}
+}
+
+func TestChangeTracker(t *testing.T) {
+	link := func(ifname string, up, removed bool) NetEvent {
+		return NetEvent{Kind: EventLink, Interface: ifname, Known: true, Up: up, Removed: removed}
+	}
+	addr := func(ifname, ip string, temporary, removed bool) NetEvent {
+		return NetEvent{Kind: EventAddress, Interface: ifname, Known: true, Addr: net.ParseIP(ip), Temporary: temporary, Removed: removed}
+	}
+	tr := &ChangeTracker{
+		up:    map[string]bool{"eth0": true},
+		addrs: map[string]bool{"eth0/10.0.0.2": true, "eth0/2001:db8::2": true},
+	}
+	steps := []struct {
+		name string
+		ev   NetEvent
+		want bool
+	}{
+		{"link attribute update", link("eth0", true, false), false},
+		{"carrier lost", link("eth0", false, false), true},
+		{"still down", link("eth0", false, false), false},
+		{"carrier back", link("eth0", true, false), true},
+		{"new interface down", link("veth1", false, false), false},
+		{"new interface up", link("wlan0", true, false), true},
+		{"interface removed", link("wlan0", false, true), true},
+		{"lifetime refresh", addr("eth0", "2001:db8::2", false, false), false},
+		{"privacy address added", addr("eth0", "2001:db8::a1b2", true, false), false},
+		{"privacy address removed", addr("eth0", "2001:db8::a1b2", true, true), false},
+		{"unique local address", addr("eth0", "fd00::2", false, false), false},
+		{"link-local address", addr("eth0", "fe80::2", false, false), false},
+		{"stable address deprecated", addr("eth0", "2001:db8::2", true, false), true},
+		{"new stable address", addr("eth0", "2001:db8::3", false, false), true},
+		{"DHCP renewal, same lease", addr("eth0", "10.0.0.2", false, false), false},
+		{"DHCP lease lost", addr("eth0", "10.0.0.2", false, true), true},
+		{"new DHCP lease", addr("eth0", "10.0.0.7", false, false), true},
+		{"no details", NetEvent{Kind: EventLink}, true},
+		{"route", NetEvent{Kind: EventRoute}, false},
+	}
+	for _, st := range steps {
+		if got := tr.Changed(st.ev); got != st.want {
+			t.Errorf("%s: changed = %v, want %v", st.name, got, st.want)
+		}
+	}
+}
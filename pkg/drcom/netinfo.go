@@ -0,0 +1,150 @@
+package drcom
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// LocalAddr is the local side used to talk to the portal.
+type LocalAddr struct {
+	Interface string
+	IP        net.IP
+	MAC       net.HardwareAddr
+}
+
+// DetectLocalAddr finds the interface facing the portal host without
+// needing a default route. In order it tries:
+//
+//  1. ifname, if given;
+//  2. an interface whose subnet contains the portal address;
+//  3. the routing table entry for the portal address (Linux);
+//  4. the source address the kernel picks for a UDP socket (no packet is sent).
+func DetectLocalAddr(host, ifname string) (*LocalAddr, error) {
+	if ifname != "" {
+		return addrOnInterface(ifname)
+	}
+	target := resolveHost(host)
+	if target == nil {
+		return nil, fmt.Errorf("cannot resolve portal host %q", host)
+	}
+	v6 := target.To4() == nil
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			n, ok := a.(*net.IPNet)
+			if ok && n.Contains(target) {
+				return &LocalAddr{Interface: iface.Name, IP: n.IP, MAC: iface.HardwareAddr}, nil
+			}
+		}
+	}
+
+	if !v6 {
+		if name, _, err := routeFor(target); err == nil && name != "" {
+			return addrOnInterface(name)
+		}
+	}
+
+	network := "udp4"
+	if v6 {
+		network = "udp6"
+	}
+	conn, err := net.Dial(network, net.JoinHostPort(target.String(), "80"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	la := &LocalAddr{IP: ip}
+	if iface := interfaceForIP(ip); iface != nil {
+		la.Interface = iface.Name
+		la.MAC = iface.HardwareAddr
+	}
+	return la, nil
+}
+
+// addrOnInterface returns the first usable IPv4 address of ifname.
+func addrOnInterface(ifname string) (*LocalAddr, error) {
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := interfaceIP(ifname, false)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalAddr{Interface: iface.Name, IP: ip, MAC: iface.HardwareAddr}, nil
+}
+
+// resolveHost extracts the host from a portal URL (or bare host) and
+// resolves it, returning nil on failure.
+func resolveHost(host string) net.IP {
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil {
+			host = u.Hostname()
+		}
+	} else if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 {
+		return nil
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip
+		}
+	}
+	return ips[0]
+}
+
+// interfaceForIP returns the interface holding ip.
+func interfaceForIP(ip net.IP) *net.Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	for i := range ifaces {
+		addrs, err := ifaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return &ifaces[i]
+			}
+		}
+	}
+	return nil
+}
+
+// macForIP returns the hardware address of the interface holding ip.
+func macForIP(ip net.IP) net.HardwareAddr {
+	if iface := interfaceForIP(ip); iface != nil {
+		return iface.HardwareAddr
+	}
+	return nil
+}
+
+// formatMAC renders a MAC the way ePortal expects it: 12 hex digits.
+func formatMAC(mac net.HardwareAddr) string {
+	if len(mac) == 0 {
+		return "000000000000"
+	}
+	return strings.ReplaceAll(mac.String(), ":", "")
+}
+
+var errNoRoute = errors.New("no matching route")
@@ -0,0 +1,215 @@
+//go:build linux
+
+package drcom
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// rtnetlink multicast groups (linux/rtnetlink.h); package syscall does
+// not define them.
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4Ifaddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+	rtmgrpIPv6Ifaddr = 0x100
+	rtmgrpIPv6Route  = 0x400
+)
+
+// netlinkSource subscribes to rtnetlink link, address and route changes.
+type netlinkSource struct{}
+
+// NewNetlinkSource returns the kernel event source for this system.
+func NewNetlinkSource() EventSource {
+	return netlinkSource{}
+}
+
+func (netlinkSource) Events(ctx context.Context) (<-chan NetEvent, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+	sa := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpLink | rtmgrpIPv4Ifaddr | rtmgrpIPv6Ifaddr | rtmgrpIPv4Route | rtmgrpIPv6Route,
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	// Wake up regularly to notice ctx being done.
+	tv := syscall.NsecToTimeval(int64(time.Second))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	ch := make(chan NetEvent)
+	go func() {
+		defer close(ch)
+		defer syscall.Close(fd)
+		buf := make([]byte, 1<<16)
+		for ctx.Err() == nil {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if err == syscall.EAGAIN || err == syscall.EINTR {
+					continue
+				}
+				if err == syscall.ENOBUFS {
+					// Events were dropped; report a generic change.
+					n = 0
+				} else {
+					return
+				}
+			}
+			var events []NetEvent
+			if n == 0 {
+				events = []NetEvent{{Kind: EventLink, Time: time.Now()}}
+			} else {
+				events = parseNetlink(buf[:n])
+			}
+			for _, ev := range events {
+				select {
+				case ch <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// parseNetlink turns rtnetlink messages into events.
+func parseNetlink(b []byte) []NetEvent {
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	var out []NetEvent
+	for i := range msgs {
+		m := &msgs[i]
+		ev := NetEvent{Time: now}
+		switch m.Header.Type {
+		case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+			ev.Kind = EventLink
+			if name, up, ok := linkInfo(m); ok {
+				ev.Interface, ev.Up, ev.Known = name, up, true
+				ev.Removed = m.Header.Type == syscall.RTM_DELLINK
+			}
+		case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+			ev.Kind = EventAddress
+			if idx, ip, temporary, ok := addrInfo(m); ok {
+				if iface, err := net.InterfaceByIndex(idx); err == nil {
+					ev.Interface = iface.Name
+				}
+				ev.Addr, ev.Temporary, ev.Known = ip, temporary, true
+				ev.Removed = m.Header.Type == syscall.RTM_DELADDR
+			}
+		case syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
+			ev.Kind = EventRoute
+		default:
+			continue
+		}
+		out = append(out, ev)
+	}
+	return out
+}
+
+// linkInfo decodes an ifinfomsg: the interface name, which is still known
+// for removed links, and whether it is up with carrier.
+func linkInfo(m *syscall.NetlinkMessage) (name string, up, ok bool) {
+	if len(m.Data) < syscall.SizeofIfInfomsg {
+		return "", false, false
+	}
+	flags := binary.NativeEndian.Uint32(m.Data[8:12])
+	up = flags&syscall.IFF_UP != 0 && flags&syscall.IFF_RUNNING != 0
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return "", false, false
+	}
+	for _, a := range attrs {
+		if a.Attr.Type == syscall.IFLA_IFNAME {
+			return strings.TrimRight(string(a.Value), "\x00"), up, true
+		}
+	}
+	return "", false, false
+}
+
+// ifaFlags is IFA_FLAGS, the 32-bit address flags (Linux 3.14+).
+const ifaFlags = 8
+
+// unstableFlags mark addresses that are not kept for new sessions.
+const unstableFlags = syscall.IFA_F_TEMPORARY | syscall.IFA_F_DEPRECATED | syscall.IFA_F_TENTATIVE | syscall.IFA_F_DADFAILED
+
+// addrInfo decodes an ifaddrmsg: the interface index, the address and
+// whether it is temporary, deprecated or tentative.
+func addrInfo(m *syscall.NetlinkMessage) (index int, ip net.IP, temporary, ok bool) {
+	if len(m.Data) < syscall.SizeofIfAddrmsg {
+		return 0, nil, false, false
+	}
+	flags := uint32(m.Data[2])
+	index = int(binary.NativeEndian.Uint32(m.Data[4:8]))
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return 0, nil, false, false
+	}
+	var address, local net.IP
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.IFA_ADDRESS:
+			address = append(net.IP(nil), a.Value...)
+		case syscall.IFA_LOCAL:
+			local = append(net.IP(nil), a.Value...)
+		case ifaFlags:
+			if len(a.Value) >= 4 {
+				flags = binary.NativeEndian.Uint32(a.Value)
+			}
+		}
+	}
+	// IFA_ADDRESS is the peer on point-to-point links; IFA_LOCAL is ours.
+	ip = local
+	if ip == nil {
+		ip = address
+	}
+	if ip == nil {
+		return 0, nil, false, false
+	}
+	return index, ip, flags&unstableFlags != 0, true
+}
+
+// interfaceAddrs dumps the addresses of all interfaces with their flags,
+// which package net does not expose.
+func interfaceAddrs() ([]ifAddr, error) {
+	b, err := syscall.NetlinkRIB(syscall.RTM_GETADDR, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	names := map[int]string{}
+	if ifaces, err := net.Interfaces(); err == nil {
+		for _, iface := range ifaces {
+			names[iface.Index] = iface.Name
+		}
+	}
+	var out []ifAddr
+	for i := range msgs {
+		m := &msgs[i]
+		if m.Header.Type != syscall.RTM_NEWADDR {
+			continue
+		}
+		if idx, ip, temporary, ok := addrInfo(m); ok && names[idx] != "" {
+			out = append(out, ifAddr{iface: names[idx], ip: ip, temporary: temporary})
+		}
+	}
+	return out, nil
+}
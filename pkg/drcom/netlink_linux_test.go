@@ -0,0 +1,100 @@
+//go:build linux
+
+package drcom
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+)
+
+// rtAttr encodes one rtattr, padded to 4 bytes.
+func rtAttr(typ uint16, value []byte) []byte {
+	b := make([]byte, 4, 4+len(value)+3)
+	binary.NativeEndian.PutUint16(b[0:2], uint16(4+len(value)))
+	binary.NativeEndian.PutUint16(b[2:4], typ)
+	b = append(b, value...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// nlMsg wraps a message body in a netlink header.
+func nlMsg(typ uint16, body ...[]byte) []byte {
+	var data []byte
+	for _, b := range body {
+		data = append(data, b...)
+	}
+	h := make([]byte, syscall.NLMSG_HDRLEN)
+	binary.NativeEndian.PutUint32(h[0:4], uint32(len(h)+len(data)))
+	binary.NativeEndian.PutUint16(h[4:6], typ)
+	return append(h, data...)
+}
+
+func ifInfo(index int, flags uint32) []byte {
+	b := make([]byte, syscall.SizeofIfInfomsg)
+	binary.NativeEndian.PutUint32(b[4:8], uint32(index))
+	binary.NativeEndian.PutUint32(b[8:12], flags)
+	return b
+}
+
+func ifAddrMsg(family byte, index int, flags byte) []byte {
+	b := make([]byte, syscall.SizeofIfAddrmsg)
+	b[0], b[2] = family, flags
+	binary.NativeEndian.PutUint32(b[4:8], uint32(index))
+	return b
+}
+
+func TestParseNetlink(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("no loopback interface")
+	}
+	flags32 := make([]byte, 4)
+	binary.NativeEndian.PutUint32(flags32, syscall.IFA_F_TEMPORARY)
+
+	var buf []byte
+	buf = append(buf, nlMsg(syscall.RTM_NEWLINK, ifInfo(99, syscall.IFF_UP|syscall.IFF_RUNNING), rtAttr(syscall.IFLA_IFNAME, []byte("eth9\x00")))...)
+	buf = append(buf, nlMsg(syscall.RTM_DELLINK, ifInfo(99, syscall.IFF_UP), rtAttr(syscall.IFLA_IFNAME, []byte("eth9\x00")))...)
+	// Point-to-point: IFA_LOCAL is ours, IFA_ADDRESS the peer.
+	buf = append(buf, nlMsg(syscall.RTM_NEWADDR, ifAddrMsg(syscall.AF_INET, lo.Index, 0),
+		rtAttr(syscall.IFA_ADDRESS, net.IPv4(10, 0, 0, 1).To4()), rtAttr(syscall.IFA_LOCAL, net.IPv4(10, 0, 0, 2).To4()))...)
+	// The 8-bit flags are truncated; IFA_FLAGS carries the full set.
+	buf = append(buf, nlMsg(syscall.RTM_DELADDR, ifAddrMsg(syscall.AF_INET6, lo.Index, 0),
+		rtAttr(syscall.IFA_ADDRESS, net.ParseIP("2001:db8::a1b2")), rtAttr(ifaFlags, flags32))...)
+	buf = append(buf, nlMsg(syscall.RTM_NEWROUTE, make([]byte, syscall.SizeofRtMsg))...)
+
+	evs := parseNetlink(buf)
+	want := []NetEvent{
+		{Kind: EventLink, Interface: "eth9", Known: true, Up: true},
+		{Kind: EventLink, Interface: "eth9", Known: true, Removed: true},
+		{Kind: EventAddress, Interface: lo.Name, Known: true, Addr: net.IPv4(10, 0, 0, 2).To4()},
+		{Kind: EventAddress, Interface: lo.Name, Known: true, Addr: net.ParseIP("2001:db8::a1b2"), Temporary: true, Removed: true},
+		{Kind: EventRoute},
+	}
+	if len(evs) != len(want) {
+		t.Fatalf("%d events, want %d: %+v", len(evs), len(want), evs)
+	}
+	for i, ev := range evs {
+		w := want[i]
+		if ev.Kind != w.Kind || ev.Interface != w.Interface || ev.Known != w.Known || ev.Up != w.Up ||
+			!ev.Addr.Equal(w.Addr) || ev.Temporary != w.Temporary || ev.Removed != w.Removed {
+			t.Errorf("event %d: %+v, want %+v", i, ev, w)
+		}
+	}
+}
+
+func TestInterfaceAddrs(t *testing.T) {
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		t.Skipf("netlink unavailable: %v", err)
+	}
+	for _, a := range addrs {
+		if a.ip.IsLoopback() && a.iface != "" {
+			return
+		}
+	}
+	t.Fatalf("loopback address missing from %+v", addrs)
+}
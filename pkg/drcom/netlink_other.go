@@ -0,0 +1,42 @@
+//go:build !linux
+
+package drcom
+
+import (
+	"context"
+	"net"
+)
+
+type noEventSource struct{}
+
+// NewNetlinkSource returns a source that always fails with
+// ErrEventsUnsupported; rtnetlink only exists on Linux.
+func NewNetlinkSource() EventSource {
+	return noEventSource{}
+}
+
+func (noEventSource) Events(ctx context.Context) (<-chan NetEvent, error) {
+	return nil, ErrEventsUnsupported
+}
+
+// interfaceAddrs lists the addresses of all interfaces. Lifetimes are not
+// available, so no address is reported as temporary.
+func interfaceAddrs() ([]ifAddr, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var out []ifAddr
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok {
+				out = append(out, ifAddr{iface: iface.Name, ip: n.IP})
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,174 @@
+package drcom
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout   = 5 * time.Second
+	defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/143.0.0.0 Safari/537.36"
+)
+
+// Logger is the minimal logging interface used by the client.
+// *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Option configures a DrComClient created by NewClient.
+type Option func(*DrComClient)
+
+// WithTimeout sets the per-request timeout of the shared HTTP client.
+func WithTimeout(d time.Duration) Option {
+	return func(c *DrComClient) {
+		c.timeout = d
+	}
+}
+
+// WithTransport replaces the HTTP transport, e.g. with a fake in tests.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *DrComClient) {
+		c.transport = rt
+	}
+}
+
+// WithUserAgent overrides the browser User-Agent sent to the portal.
+func WithUserAgent(ua string) Option {
+	return func(c *DrComClient) {
+		c.userAgent = ua
+	}
+}
+
+// WithReferer overrides the Referer header (defaults to Host + "/").
+func WithReferer(referer string) Option {
+	return func(c *DrComClient) {
+		c.referer = referer
+	}
+}
+
+// WithLogger enables debug logging of portal requests.
+func WithLogger(l Logger) Option {
+	return func(c *DrComClient) {
+		c.logger = l
+	}
+}
+
+// WithClock replaces time.Now, mainly for tests.
+func WithClock(now func() time.Time) Option {
+	return func(c *DrComClient) {
+		c.now = now
+	}
+}
+
+// WithOutcomeRules adds site-specific ret_code/msg mappings that are
+// checked before DefaultOutcomeRules.
+func WithOutcomeRules(rules ...OutcomeRule) Option {
+	return func(c *DrComClient) {
+		c.classifier = NewClassifier(rules...)
+	}
+}
+
+// WithProfile selects the ePortal request shape; see Presets.
+func WithProfile(p Profile) Option {
+	return func(c *DrComClient) {
+		c.profile = p
+	}
+}
+
+// WithInterface sends portal traffic through ifname (SO_BINDTODEVICE on
+// Linux with root or CAP_NET_RAW, else its address as source) and uses its
+// address and MAC.
+// It has no effect on the binding when WithTransport is also given.
+func WithInterface(ifname string) Option {
+	return func(c *DrComClient) {
+		c.iface = ifname
+	}
+}
+
+// WithIP overrides the detected local IP sent as wlan_user_ip.
+func WithIP(ip string) Option {
+	return func(c *DrComClient) {
+		c.IP = ip
+	}
+}
+
+// WithMAC overrides the detected MAC sent as wlan_user_mac.
+func WithMAC(mac net.HardwareAddr) Option {
+	return func(c *DrComClient) {
+		c.mac = mac
+	}
+}
+
+// WithIPMode selects the address families to authenticate (default v4).
+func WithIPMode(m IPMode) Option {
+	return func(c *DrComClient) {
+		c.ipMode = m
+	}
+}
+
+// WithIPv6 overrides the detected local IPv6 sent as wlan_user_ipv6.
+func WithIPv6(ip string) Option {
+	return func(c *DrComClient) {
+		c.IPv6 = ip
+	}
+}
+
+// WithACParams adds the access-controller parameters from the captive
+// redirect (wlan_ac_ip, wlan_ac_name, ...) to the login request.
+func WithACParams(params map[string]string) Option {
+	return func(c *DrComClient) {
+		c.acParams = params
+	}
+}
+
+// WithHosts configures equivalent portal hosts in order of preference.
+// The first one replaces the host passed to NewClient; requests fail over
+// between them and return to the primary once it recovers.
+func WithHosts(hosts ...string) Option {
+	return func(c *DrComClient) {
+		var urls []string
+		for _, h := range hosts {
+			if h = strings.TrimRight(h, "/"); h != "" {
+				urls = append(urls, h)
+			}
+		}
+		if len(urls) == 0 {
+			return
+		}
+		c.Host = urls[0]
+		if len(urls) > 1 {
+			c.pool = newHostPool(urls)
+		}
+	}
+}
+
+// WithTLS sets the TLS configuration for HTTPS portals, see TLSOptions.
+// Like WithInterface it is ignored when WithTransport is given.
+func WithTLS(conf *tls.Config) Option {
+	return func(c *DrComClient) {
+		c.tlsConfig = conf
+	}
+}
+
+// WithCookieJar keeps portal cookies across requests, see NewFileJar.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c *DrComClient) {
+		c.jar = jar
+	}
+}
+
+// WithPreLogin runs steps before every login; extracted tokens can be used
+// as {name} in Profile.Extra.
+func WithPreLogin(steps ...PreLoginStep) Option {
+	return func(c *DrComClient) {
+		c.preLogin = steps
+	}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...interface{}) {}
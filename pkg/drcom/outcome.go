@@ -0,0 +1,226 @@
+package drcom
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LoginOutcome is the typed result of a login attempt.
+type LoginOutcome int
+
+const (
+	OutcomeUnknown LoginOutcome = iota
+	OutcomeSuccess
+	OutcomeAlreadyOnline
+	OutcomeWrongPassword
+	OutcomeAccountArrears
+	OutcomeAccountDisabled
+	OutcomeTooManyDevices
+	OutcomeRateLimited
+	OutcomePortalError
+)
+
+var outcomeNames = map[LoginOutcome]string{
+	OutcomeUnknown:         "unknown",
+	OutcomeSuccess:         "success",
+	OutcomeAlreadyOnline:   "already_online",
+	OutcomeWrongPassword:   "wrong_password",
+	OutcomeAccountArrears:  "account_arrears",
+	OutcomeAccountDisabled: "account_disabled",
+	OutcomeTooManyDevices:  "too_many_devices",
+	OutcomeRateLimited:     "rate_limited",
+	OutcomePortalError:     "portal_error",
+}
+
+// Sentinel errors returned (wrapped in *LoginError) for failed logins.
+var (
+	ErrWrongPassword   = errors.New("wrong username or password")
+	ErrAccountArrears  = errors.New("account in arrears")
+	ErrAccountDisabled = errors.New("account disabled")
+	ErrTooManyDevices  = errors.New("too many devices online")
+	ErrRateLimited     = errors.New("rate limited by portal")
+	ErrPortalError     = errors.New("portal error")
+	ErrUnknownOutcome  = errors.New("unknown login result")
+)
+
+var outcomeErrors = map[LoginOutcome]error{
+	OutcomeWrongPassword:   ErrWrongPassword,
+	OutcomeAccountArrears:  ErrAccountArrears,
+	OutcomeAccountDisabled: ErrAccountDisabled,
+	OutcomeTooManyDevices:  ErrTooManyDevices,
+	OutcomeRateLimited:     ErrRateLimited,
+	OutcomePortalError:     ErrPortalError,
+	OutcomeUnknown:         ErrUnknownOutcome,
+}
+
+func (o LoginOutcome) String() string {
+	if name, ok := outcomeNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("LoginOutcome(%d)", int(o))
+}
+
+// MarshalText makes outcomes show up by name in JSON.
+func (o LoginOutcome) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// OK reports whether the host is online after the attempt.
+func (o LoginOutcome) OK() bool {
+	return o == OutcomeSuccess || o == OutcomeAlreadyOnline
+}
+
+// UnmarshalText is the inverse of MarshalText.
+func (o *LoginOutcome) UnmarshalText(text []byte) error {
+	v, err := ParseOutcome(string(text))
+	if err != nil {
+		return err
+	}
+	*o = v
+	return nil
+}
+
+// Permanent reports whether retrying cannot succeed until someone fixes
+// the account: wrong credentials, arrears or a disabled account. Retrying
+// these only risks a lockout.
+func (o LoginOutcome) Permanent() bool {
+	return o == OutcomeWrongPassword || o == OutcomeAccountArrears || o == OutcomeAccountDisabled
+}
+
+// Err returns the sentinel error for a failed outcome, or nil.
+func (o LoginOutcome) Err() error {
+	if o.OK() {
+		return nil
+	}
+	return outcomeErrors[o]
+}
+
+// ParseOutcome converts a config name such as "wrong_password" to an outcome.
+func ParseOutcome(name string) (LoginOutcome, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for o, n := range outcomeNames {
+		if n == name {
+			return o, nil
+		}
+	}
+	return OutcomeUnknown, fmt.Errorf("unknown login outcome %q", name)
+}
+
+// LoginError carries the portal's message for a failed login.
+// It unwraps to one of the sentinel errors above.
+type LoginError struct {
+	Outcome LoginOutcome
+	Msg     string
+	RetCode string
+}
+
+func (e *LoginError) Error() string {
+	if e.Msg == "" {
+		return fmt.Sprintf("login failed: %v (ret_code: %s)", e.Outcome.Err(), e.RetCode)
+	}
+	return fmt.Sprintf("login failed: %v: %s", e.Outcome.Err(), e.Msg)
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Outcome.Err()
+}
+
+// OutcomeRule maps a ret_code and/or a message fragment to an outcome.
+// Empty fields match anything; a rule with both fields empty never matches.
+type OutcomeRule struct {
+	RetCode string
+	Msg     string
+	Outcome LoginOutcome
+}
+
+// DefaultOutcomeRules covers the wording of the ePortal builds seen so far.
+// Rules are tried in order; ret_code-only rules come last, so a known
+// message wins over a ret_code that some builds reuse for other errors.
+var DefaultOutcomeRules = []OutcomeRule{
+	{Msg: "已经在线", Outcome: OutcomeAlreadyOnline},
+	{Msg: "已在线", Outcome: OutcomeAlreadyOnline},
+	{Msg: "密码错误", Outcome: OutcomeWrongPassword},
+	{Msg: "账号或密码", Outcome: OutcomeWrongPassword},
+	{Msg: "账号不存在", Outcome: OutcomeWrongPassword},
+	{Msg: "userid error", Outcome: OutcomeWrongPassword},
+	{Msg: "ldap auth error", Outcome: OutcomeWrongPassword},
+	{Msg: "欠费", Outcome: OutcomeAccountArrears},
+	{Msg: "余额不足", Outcome: OutcomeAccountArrears},
+	{Msg: "arrearage", Outcome: OutcomeAccountArrears},
+	{Msg: "停机", Outcome: OutcomeAccountDisabled},
+	{Msg: "禁用", Outcome: OutcomeAccountDisabled},
+	{Msg: "冻结", Outcome: OutcomeAccountDisabled},
+	{Msg: "终端数", Outcome: OutcomeTooManyDevices},
+	{Msg: "在线数", Outcome: OutcomeTooManyDevices},
+	{Msg: "频繁", Outcome: OutcomeRateLimited},
+	{Msg: "稍后再试", Outcome: OutcomeRateLimited},
+	{Msg: "系统繁忙", Outcome: OutcomePortalError},
+	{Msg: "radius", Outcome: OutcomePortalError},
+	{RetCode: "2", Outcome: OutcomeAlreadyOnline},
+}
+
+// Classifier turns raw portal responses into typed outcomes.
+type Classifier struct {
+	rules []OutcomeRule
+}
+
+// NewClassifier returns a classifier that checks extra before the defaults,
+// so site-specific rules can override the built-in wording.
+func NewClassifier(extra ...OutcomeRule) *Classifier {
+	rules := make([]OutcomeRule, 0, len(extra)+len(DefaultOutcomeRules))
+	rules = append(rules, extra...)
+	rules = append(rules, DefaultOutcomeRules...)
+	return &Classifier{rules: rules}
+}
+
+// Classify maps a login response to an outcome. result=1 always wins.
+func (cl *Classifier) Classify(resp *LoginResponse) LoginOutcome {
+	if resp == nil {
+		return OutcomeUnknown
+	}
+	if anyString(resp.Result) == "1" {
+		return OutcomeSuccess
+	}
+	return cl.Match(anyString(resp.RetCode), resp.Msg)
+}
+
+// Match applies the rule table to a ret_code/message pair.
+func (cl *Classifier) Match(retCode, msg string) LoginOutcome {
+	msg = strings.ToLower(msg)
+	for _, r := range cl.rules {
+		if r.RetCode == "" && r.Msg == "" {
+			continue
+		}
+		if r.RetCode != "" && r.RetCode != retCode {
+			continue
+		}
+		if r.Msg != "" && !strings.Contains(msg, strings.ToLower(r.Msg)) {
+			continue
+		}
+		return r.Outcome
+	}
+	return OutcomeUnknown
+}
+
+// Err wraps a failed response into a *LoginError, or returns nil on success.
+func (cl *Classifier) Err(resp *LoginResponse) error {
+	o := cl.Classify(resp)
+	if o.OK() {
+		return nil
+	}
+	e := &LoginError{Outcome: o}
+	if resp != nil {
+		e.Msg = resp.Msg
+		e.RetCode = anyString(resp.RetCode)
+	}
+	return e
+}
+
+// anyString formats loosely typed JSON fields ("1", 1, nil) uniformly.
+func anyString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,119 @@
+package drcom
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  interface{}
+		retCode interface{}
+		msg     string
+		want    LoginOutcome
+	}{
+		{"result string", "1", nil, "Portal协议认证成功！", OutcomeSuccess},
+		{"result number", float64(1), float64(2), "", OutcomeSuccess},
+		{"ret_code only", "0", float64(2), "", OutcomeAlreadyOnline},
+		{"ret_code as string", "0", "2", "", OutcomeAlreadyOnline},
+		{"already online", "0", nil, "IP: 10.0.0.2 已经在线！", OutcomeAlreadyOnline},
+		{"wrong password", "0", float64(1), "账号或密码错误(ldap校验)", OutcomeWrongPassword},
+		{"case insensitive", "0", nil, "LDAP AUTH ERROR", OutcomeWrongPassword},
+		{"msg beats ret_code", "0", float64(2), "密码错误", OutcomeWrongPassword},
+		{"arrears", "0", nil, "账户余额不足", OutcomeAccountArrears},
+		{"disabled", "0", nil, "账号已被冻结", OutcomeAccountDisabled},
+		{"devices", "0", nil, "终端数超过限制", OutcomeTooManyDevices},
+		{"rate limited", "0", nil, "操作频繁，请稍后再试", OutcomeRateLimited},
+		{"portal error", "0", nil, "radius认证超时", OutcomePortalError},
+		{"unknown", "0", float64(9), "未知错误", OutcomeUnknown},
+		{"empty", nil, nil, "", OutcomeUnknown},
+	}
+	cl := NewClassifier()
+	for _, tt := range tests {
+		resp := &LoginResponse{Result: tt.result, RetCode: tt.retCode, Msg: tt.msg}
+		if got := cl.Classify(resp); got != tt.want {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got := cl.Classify(nil); got != OutcomeUnknown {
+		t.Errorf("nil response: %v", got)
+	}
+}
+
+func TestClassifierExtraRules(t *testing.T) {
+	cl := NewClassifier(
+		OutcomeRule{Msg: "用户不存在", Outcome: OutcomeWrongPassword},
+		OutcomeRule{RetCode: "8", Outcome: OutcomeAccountArrears},
+		// Overrides the built-in meaning of ret_code 2 for one message.
+		OutcomeRule{RetCode: "2", Msg: "认证中", Outcome: OutcomeRateLimited},
+		OutcomeRule{}, // Matches nothing
+	)
+	tests := []struct {
+		retCode string
+		msg     string
+		want    LoginOutcome
+	}{
+		{"1", "用户不存在", OutcomeWrongPassword},
+		{"8", "", OutcomeAccountArrears},
+		// Extra rules are checked before the built-in message rules.
+		{"8", "密码错误", OutcomeAccountArrears},
+		{"2", "正在认证中", OutcomeRateLimited},
+		{"2", "", OutcomeAlreadyOnline},
+		{"3", "", OutcomeUnknown},
+	}
+	for _, tt := range tests {
+		if got := cl.Match(tt.retCode, tt.msg); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.retCode, tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestLoginOutcome(t *testing.T) {
+	for o, name := range outcomeNames {
+		parsed, err := ParseOutcome(" " + name + " ")
+		if err != nil || parsed != o {
+			t.Errorf("ParseOutcome(%q) = %v, %v", name, parsed, err)
+		}
+		text, _ := o.MarshalText()
+		var back LoginOutcome
+		if err := back.UnmarshalText(text); err != nil || back != o {
+			t.Errorf("%v: round trip gave %v, %v", o, back, err)
+		}
+		if o.OK() != (o.Err() == nil) {
+			t.Errorf("%v: OK %v but Err %v", o, o.OK(), o.Err())
+		}
+	}
+	if _, err := ParseOutcome("bogus"); err == nil {
+		t.Error("ParseOutcome accepted an unknown name")
+	}
+	if LoginOutcome(42).String() != "LoginOutcome(42)" {
+		t.Errorf("String of an unnamed outcome: %s", LoginOutcome(42))
+	}
+
+	permanent := map[LoginOutcome]bool{OutcomeWrongPassword: true, OutcomeAccountArrears: true, OutcomeAccountDisabled: true}
+	for o := range outcomeNames {
+		if o.Permanent() != permanent[o] {
+			t.Errorf("%v: Permanent %v", o, o.Permanent())
+		}
+	}
+}
+
+func TestClassifierErr(t *testing.T) {
+	cl := NewClassifier()
+	if err := cl.Err(&LoginResponse{Result: "1"}); err != nil {
+		t.Fatalf("success: %v", err)
+	}
+	err := cl.Err(&LoginResponse{Result: "0", RetCode: float64(1), Msg: "本账号已欠费"})
+	var le *LoginError
+	if !errors.As(err, &le) || le.RetCode != "1" || le.Msg != "本账号已欠费" {
+		t.Fatalf("error %#v", err)
+	}
+	if !errors.Is(err, ErrAccountArrears) || errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("%v does not unwrap to ErrAccountArrears", err)
+	}
+	err = cl.Err(&LoginResponse{Result: "0", RetCode: "9"})
+	if !errors.Is(err, ErrUnknownOutcome) || err.Error() != "login failed: unknown login result (ret_code: 9)" {
+		t.Fatalf("unknown: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package drcom
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// encodePassword returns the password as the portal expects it and
+// whether it was encrypted.
+func (p Profile) encodePassword(password string) (string, bool, error) {
+	switch p.Encryption {
+	case "", EncryptNone:
+		return password, false, nil
+	case EncryptMD5:
+		sum := md5.Sum([]byte(p.MD5Salt + password))
+		return hex.EncodeToString(sum[:]), true, nil
+	case EncryptRSA:
+		if p.PublicKey != "" {
+			s, err := rsaPKCS1(password, p.PublicKey)
+			return s, err == nil, err
+		}
+		s, err := rsaNoPadding(password, p.RSAModulus, p.RSAExponent)
+		return s, err == nil, err
+	}
+	return "", false, fmt.Errorf("unknown password encryption %q", p.Encryption)
+}
+
+// rsaNoPadding mirrors encryptedString() from the security.js shipped with
+// ePortal: textbook RSA on the password bytes, hex encoded. The script
+// reverses the password and packs it little-endian, which cancels out to
+// the plain big-endian integer. Like biToHex, the hex is written in
+// 16-bit digits, so it is padded to a multiple of four characters rather
+// than to the modulus length.
+func rsaNoPadding(password, modulusHex, exponentHex string) (string, error) {
+	n, ok := new(big.Int).SetString(modulusHex, 16)
+	if !ok || n.Sign() <= 0 {
+		return "", errors.New("invalid RSA modulus")
+	}
+	if exponentHex == "" {
+		exponentHex = "10001"
+	}
+	e, ok := new(big.Int).SetString(exponentHex, 16)
+	if !ok {
+		return "", errors.New("invalid RSA exponent")
+	}
+	m := new(big.Int).SetBytes([]byte(password))
+	if m.Cmp(n) >= 0 {
+		return "", errors.New("password too long for the RSA key")
+	}
+	c := new(big.Int).Exp(m, e, n)
+	digits := (len(c.Text(16)) + 3) / 4
+	return fmt.Sprintf("%0*x", 4*digits, c), nil
+}
+
+// rsaPKCS1 encrypts like JSEncrypt: PKCS#1 v1.5, base64 encoded. key is a
+// PEM block or its bare base64 body.
+func rsaPKCS1(password, key string) (string, error) {
+	pub, err := parsePublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	out, err := rsa.EncryptPKCS1v15(rand.Reader, pub, []byte(password))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+func parsePublicKey(key string) (*rsa.PublicKey, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(key)); block != nil {
+		der = block.Bytes
+	} else {
+		var err error
+		if der, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(key), "")); err != nil {
+			return nil, fmt.Errorf("invalid RSA public key: %v", err)
+		}
+	}
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		if rsaPub, ok := pub.(*rsa.PublicKey); ok {
+			return rsaPub, nil
+		}
+		return nil, errors.New("public key is not RSA")
+	}
+	return x509.ParsePKCS1PublicKey(der)
+}
+
+// resolveEncryption fingerprints the portal once when the profile asks for
+// EncryptAuto, and keeps the detected scheme and key.
+func (c *DrComClient) resolveEncryption(ctx context.Context) error {
+	if c.currentProfile().Encryption != EncryptAuto {
+		return nil
+	}
+	fp, err := c.fingerprint(ctx)
+	if err != nil && fp == nil {
+		return fmt.Errorf("detecting password encryption: %w", err)
+	}
+	c.mu.Lock()
+	c.profile.Encryption = fp.Encryption
+	c.profile.RSAModulus, c.profile.RSAExponent, c.profile.PublicKey = fp.RSAModulus, fp.RSAExponent, fp.PublicKey
+	c.mu.Unlock()
+	c.logger.Printf("detected password encryption: %s", fp.Encryption)
+	return nil
+}
@@ -0,0 +1,215 @@
+package drcom
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testPassword = "Pa55-wörd"
+
+var (
+	testKeyOnce sync.Once
+	testKey     *rsa.PrivateKey
+)
+
+func rsaTestKey(t *testing.T) *rsa.PrivateKey {
+	testKeyOnce.Do(func() {
+		var err error
+		if testKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return testKey
+}
+
+// Password schemes the stand-in portal can verify.
+const (
+	schemePlain = "plain"
+	schemeMD5   = "md5"
+	schemeRaw   = "rsa-raw"   // security.js encryptedString, hex
+	schemePKCS1 = "rsa-pkcs1" // JSEncrypt, base64
+)
+
+// passwordPortal is a stand-in ePortal that serves a landing page with
+// script and decrypts user_password on login.
+type passwordPortal struct {
+	t      *testing.T
+	key    *rsa.PrivateKey
+	script string // Content of /eportal/js/security.js
+	scheme string // How user_password must be encoded
+	salt   string
+	logins int
+}
+
+func (p *passwordPortal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		fmt.Fprint(w, `<html><head><script src="https://cdn.example.com/jquery.js"></script>`+
+			`<script src="/eportal/js/security.js"></script></head>`+
+			`<body><script>var api = "/eportal/portal/login"; var jsVersion = "4.1.3";</script></body></html>`)
+	case "/eportal/js/security.js":
+		fmt.Fprint(w, p.script)
+	case "/eportal/portal/login":
+		p.logins++
+		q := r.URL.Query()
+		if got := p.decode(q.Get("user_password")); got != testPassword {
+			p.t.Errorf("%s: password decodes to %q", p.scheme, got)
+		}
+		if want := map[bool]string{true: "", false: "1"}[p.scheme == schemePlain]; q.Get("encrypt") != want {
+			p.t.Errorf("%s: encrypt=%q, want %q", p.scheme, q.Get("encrypt"), want)
+		}
+		fmt.Fprintf(w, `%s({"result":1,"msg":"Portal协议认证成功！"})`, q.Get("callback"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// decode recovers the password, or for MD5 returns it if the hash matches.
+func (p *passwordPortal) decode(s string) string {
+	switch p.scheme {
+	case schemePlain:
+		return s
+	case schemeMD5:
+		sum := md5.Sum([]byte(p.salt + testPassword))
+		if s == hex.EncodeToString(sum[:]) {
+			return testPassword
+		}
+		return "md5 mismatch: " + s
+	case schemeRaw:
+		c, ok := new(big.Int).SetString(s, 16)
+		// biToHex writes whole 16-bit digits without a leading zero digit.
+		if !ok || len(s)%4 != 0 || len(s) > 4 && strings.HasPrefix(s, "0000") {
+			return "bad hex: " + s
+		}
+		return string(new(big.Int).Exp(c, p.key.D, p.key.N).Bytes())
+	case schemePKCS1:
+		ct, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return err.Error()
+		}
+		pt, err := rsa.DecryptPKCS1v15(nil, p.key, ct)
+		if err != nil {
+			return err.Error()
+		}
+		return string(pt)
+	}
+	return ""
+}
+
+func TestPasswordEncryption(t *testing.T) {
+	key := rsaTestKey(t)
+	modulus := key.N.Text(16)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.StdEncoding.EncodeToString(der)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	pkcs1PEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}))
+
+	tests := []struct {
+		name    string
+		profile Profile
+		script  string
+		scheme  string
+		salt    string
+	}{
+		{"none", Profile{}, "", schemePlain, ""},
+		{"md5", Profile{Encryption: EncryptMD5}, "", schemeMD5, ""},
+		{"md5 salted", Profile{Encryption: EncryptMD5, MD5Salt: "drcom"}, "", schemeMD5, "drcom"},
+		{"rsa modulus", Profile{Encryption: EncryptRSA, RSAModulus: modulus}, "", schemeRaw, ""},
+		{"rsa PKIX PEM", Profile{Encryption: EncryptRSA, PublicKey: pemKey}, "", schemePKCS1, ""},
+		{"rsa PKCS1 PEM", Profile{Encryption: EncryptRSA, PublicKey: pkcs1PEM}, "", schemePKCS1, ""},
+		{"rsa base64", Profile{Encryption: EncryptRSA, PublicKey: b64}, "", schemePKCS1, ""},
+
+		{"auto none", Profile{Encryption: EncryptAuto},
+			`function login() { $.get(api, {user_password: pwd}); }`, schemePlain, ""},
+		{"auto md5", Profile{Encryption: EncryptAuto},
+			`var pwd = hex_md5(password);`, schemeMD5, ""},
+		{"auto RSAKeyPair", Profile{Encryption: EncryptAuto},
+			`var key = new RSAKeyPair("10001", "", "` + modulus + `"); pwd = encryptedString(key, pwd);`, schemeRaw, ""},
+		{"auto setPublic", Profile{Encryption: EncryptAuto},
+			`rsa.setPublic("` + modulus + `", "10001");`, schemeRaw, ""},
+		{"auto JSEncrypt base64", Profile{Encryption: EncryptAuto},
+			`var publicKey = "` + b64 + `"; var enc = new JSEncrypt(); enc.setPublicKey(publicKey);`, schemePKCS1, ""},
+		{"auto JSEncrypt PEM", Profile{Encryption: EncryptAuto},
+			`var pem = "` + strings.ReplaceAll(pemKey, "\n", `\n`) + `";`, schemePKCS1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portal := &passwordPortal{t: t, key: key, script: tt.script, scheme: tt.scheme, salt: tt.salt}
+			srv := httptest.NewServer(portal)
+			defer srv.Close()
+
+			c := NewClient(srv.URL, "student", testPassword,
+				WithProfile(DefaultProfile.Merge(tt.profile)), WithIP("10.0.0.2"))
+			resp, err := c.LoginContext(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Classify(resp) != OutcomeSuccess || portal.logins != 1 {
+				t.Fatalf("login %+v after %d requests", resp, portal.logins)
+			}
+		})
+	}
+}
+
+// TestRSANoPaddingVector checks against output of encryptedString() from
+// security.js, which the page calls with the reversed password. The first
+// ciphertext is 27 hex digits long, padded to 28 by biToHex rather than
+// to the 32 digits of the modulus.
+func TestRSANoPaddingVector(t *testing.T) {
+	const modulus = "9db14bc6742d9b7d513760f19566ef55"
+	tests := []struct {
+		password string
+		want     string
+	}{
+		{"pw927617", "0d16f6c61a7278056874456a290d"},
+		{"pw25865", "9c6bff340cc57fc401764639b49a"},
+		{"Pa55", "0cb60b8caa6aa9a29e8df85e4073909a"},
+	}
+	for _, tt := range tests {
+		got, err := rsaNoPadding(tt.password, modulus, "10001")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprintPortal(t *testing.T) {
+	key := rsaTestKey(t)
+	portal := &passwordPortal{t: t, key: key, script: `rsa.setPublic("` + key.N.Text(16) + `", "10001");`}
+	srv := httptest.NewServer(portal)
+	defer srv.Close()
+
+	fp, err := FingerprintPortal(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.Driver != DriverEPortal || fp.Version != "4.1.3" || fp.Encryption != EncryptRSA {
+		t.Fatalf("fingerprint %+v", fp)
+	}
+	if fp.RSAModulus != key.N.Text(16) || fp.RSAExponent != "10001" {
+		t.Fatalf("RSA key %s/%s", fp.RSAExponent, fp.RSAModulus)
+	}
+	// The CDN script is skipped.
+	if len(fp.Scripts) != 1 || !strings.HasSuffix(fp.Scripts[0], "/eportal/js/security.js") {
+		t.Fatalf("scripts %v", fp.Scripts)
+	}
+}
@@ -0,0 +1,104 @@
+package drcom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PreLoginStep fetches a page before login, e.g. to obtain a session
+// cookie and a CSRF token. URL is absolute or a path under Host.
+type PreLoginStep struct {
+	URL     string
+	Extract []TokenRule
+}
+
+// TokenRule extracts one value from a pre-login response, by Regex (first
+// capture group, or the whole match) or by a dotted JSONPath such as
+// "data.token" or "list.0.id". The value is available as {Name} in the
+// Extra login parameters.
+type TokenRule struct {
+	Name     string
+	Regex    string
+	JSONPath string
+}
+
+// runPreLogin executes the pre-login steps and returns the tokens.
+func (c *DrComClient) runPreLogin(ctx context.Context) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, step := range c.preLogin {
+		target := step.URL
+		if !strings.Contains(target, "://") {
+			target = c.host() + "/" + strings.TrimLeft(target, "/")
+		}
+		body, err := c.doRequest(ctx, target)
+		if err != nil {
+			return nil, fmt.Errorf("pre-login %s: %w", step.URL, err)
+		}
+		for _, r := range step.Extract {
+			v, err := r.extract(body)
+			if err != nil {
+				return nil, fmt.Errorf("pre-login %s: token %s: %w", step.URL, r.Name, err)
+			}
+			tokens[r.Name] = v
+		}
+	}
+	return tokens, nil
+}
+
+func (r TokenRule) extract(body string) (string, error) {
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return "", err
+		}
+		m := re.FindStringSubmatch(body)
+		if m == nil {
+			return "", fmt.Errorf("regex %q did not match", r.Regex)
+		}
+		if len(m) > 1 {
+			return m[1], nil
+		}
+		return m[0], nil
+	}
+	var v interface{}
+	if err := parseJSONP(body, &v); err != nil {
+		return "", err
+	}
+	for _, key := range strings.Split(r.JSONPath, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", fmt.Errorf("json path %q: bad index %q", r.JSONPath, key)
+			}
+			v = node[i]
+		default:
+			v = nil
+		}
+		if v == nil {
+			return "", fmt.Errorf("json path %q not found", r.JSONPath)
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	out, err := json.Marshal(v)
+	return string(out), err
+}
+
+// expandTokens replaces {name} placeholders with extracted tokens.
+func expandTokens(s string, tokens map[string]string) string {
+	if !strings.Contains(s, "{") {
+		return s
+	}
+	for k, v := range tokens {
+		s = strings.ReplaceAll(s, "{"+k+"}", v)
+	}
+	return s
+}
@@ -0,0 +1,114 @@
+package drcom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTokenRule(t *testing.T) {
+	page := `<form><input type="hidden" name="csrf" value="c5f-01"><input name="lt" value='LT-9'></form>`
+	api := `cb({"code":0,"data":{"token":"t0k","ttl":300,"ok":true,"list":[{"id":"a"},{"id":7}],"none":null}})`
+	tests := []struct {
+		name  string
+		rule  TokenRule
+		body  string
+		want  string
+		error string
+	}{
+		{"regex group", TokenRule{Regex: `name="csrf" value="([^"]+)"`}, page, "c5f-01", ""},
+		{"regex first group only", TokenRule{Regex: `name="(lt)" value='([^']+)'`}, page, "lt", ""},
+		{"regex whole match", TokenRule{Regex: `LT-\d+`}, page, "LT-9", ""},
+		{"regex wins over json path", TokenRule{Regex: `LT-\d+`, JSONPath: "data.token"}, page, "LT-9", ""},
+		{"regex no match", TokenRule{Regex: `name="execution"`}, page, "", "did not match"},
+		{"bad regex", TokenRule{Regex: `(`}, page, "", "missing closing )"},
+		{"json string", TokenRule{JSONPath: "data.token"}, api, "t0k", ""},
+		{"json number", TokenRule{JSONPath: "data.ttl"}, api, "300", ""},
+		{"json bool", TokenRule{JSONPath: "data.ok"}, api, "true", ""},
+		{"json array index", TokenRule{JSONPath: "data.list.0.id"}, api, "a", ""},
+		{"json number in array", TokenRule{JSONPath: "data.list.1.id"}, api, "7", ""},
+		{"json object", TokenRule{JSONPath: "data.list.0"}, api, `{"id":"a"}`, ""},
+		{"plain json", TokenRule{JSONPath: "token"}, `{"token":"plain"}`, "plain", ""},
+		{"json missing key", TokenRule{JSONPath: "data.nonce"}, api, "", "not found"},
+		{"json null", TokenRule{JSONPath: "data.none"}, api, "", "not found"},
+		{"json past a leaf", TokenRule{JSONPath: "data.token.x"}, api, "", "not found"},
+		{"json index out of range", TokenRule{JSONPath: "data.list.2"}, api, "", "bad index"},
+		{"json index not a number", TokenRule{JSONPath: "data.list.id"}, api, "", "bad index"},
+		{"json from html", TokenRule{JSONPath: "data.token"}, page, "", "HTML"},
+	}
+	for _, tt := range tests {
+		got, err := tt.rule.extract(tt.body)
+		if tt.error != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("%s: %q, %v; want error %q", tt.name, got, err, tt.error)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestExpandTokens(t *testing.T) {
+	tokens := map[string]string{"csrf": "c1", "lt": "LT-9"}
+	tests := map[string]string{
+		"{csrf}":       "c1",
+		"{lt}-{csrf}":  "LT-9-c1",
+		"{missing}":    "{missing}",
+		"static":       "static",
+		"{csrf}{csrf}": "c1c1",
+		"{ csrf }":     "{ csrf }",
+		"":             "",
+	}
+	for in, want := range tests {
+		if got := expandTokens(in, tokens); got != want {
+			t.Errorf("expandTokens(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPreLogin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a79.htm":
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: "s1", Path: "/"})
+			fmt.Fprint(w, `<input type="hidden" name="csrf" value="c1">`)
+		case "/api/token":
+			if c, err := r.Cookie("JSESSIONID"); err != nil || c.Value != "s1" {
+				t.Errorf("token request without the session cookie")
+			}
+			fmt.Fprint(w, `jsonp({"data":{"token":"t2"}})`)
+		case DefaultProfile.LoginPath:
+			q := r.URL.Query()
+			c, err := r.Cookie("JSESSIONID")
+			if err != nil || c.Value != "s1" || q.Get("csrf") != "c1" || q.Get("auth") != "c1:t2" {
+				t.Errorf("login without the pre-login state: %v, cookie %v", q, c)
+			}
+			fmt.Fprintf(w, `%s({"result":1,"msg":"ok"})`, q.Get("callback"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	profile := DefaultProfile.Merge(Profile{Extra: map[string]string{"csrf": "{csrf}", "auth": "{csrf}:{token}"}})
+	c := NewClient(srv.URL, "student", "secret", WithIP("10.0.0.2"), WithProfile(profile), WithPreLogin(
+		PreLoginStep{URL: "a79.htm", Extract: []TokenRule{{Name: "csrf", Regex: `name="csrf" value="([^"]+)"`}}},
+		PreLoginStep{URL: srv.URL + "/api/token", Extract: []TokenRule{{Name: "token", JSONPath: "data.token"}}},
+	))
+	if _, err := c.LoginContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	c = NewClient(srv.URL, "student", "secret", WithIP("10.0.0.2"), WithProfile(profile), WithPreLogin(
+		PreLoginStep{URL: "/a79.htm", Extract: []TokenRule{{Name: "csrf", Regex: `name="token"`}}},
+	))
+	_, err := c.LoginContext(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "pre-login /a79.htm: token csrf") {
+		t.Fatalf("failed extraction: %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package drcom
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Callback styles for the JSONP "callback" parameter.
+const (
+	CallbackRandom = "random" // dr1234, like the portal's own JS
+	CallbackFixed  = "fixed"  // Profile.CallbackName
+	CallbackNone   = "none"   // no callback, portal answers plain JSON
+)
+
+// Unset in a Profile passed to Merge clears the field. An unset parameter
+// name drops the parameter from the requests, e.g. Names.Lang: Unset.
+const Unset = "-"
+
+// ParamNames holds the query parameter names used by an ePortal build.
+type ParamNames struct {
+	Callback     string
+	Account      string
+	Password     string
+	IP           string
+	IPv6         string
+	MAC          string
+	Encrypt      string
+	LoginMethod  string
+	JSVersion    string
+	TerminalType string
+	Lang         string
+	IsLogin      string
+}
+
+// Profile describes the request shape of one ePortal variant.
+type Profile struct {
+	Name       string
+	LoginPath  string
+	LogoutPath string
+	StatusPath string
+
+	// AccountTemplate builds user_account on login; "{account}" is
+	// replaced with the username, e.g. ",`,{account}".
+	AccountTemplate string
+	// LogoutAccountTemplate builds user_account on logout, which usually
+	// takes the bare username.
+	LogoutAccountTemplate string
+
+	Names        ParamNames
+	LoginMethod  string
+	JSVersion    string
+	TerminalType string
+	Lang         string
+	StatusLang   string // lang of the status request
+	IsLogin      string // Sent with the status request
+
+	// Extra static parameters appended to the login request.
+	Extra map[string]string
+
+	Callback     string
+	CallbackName string
+
+	// Encryption is EncryptNone (default), EncryptMD5, EncryptRSA or
+	// EncryptAuto. RSA uses either the hex modulus/exponent of the portal's
+	// security.js or a PEM/base64 public key (PKCS#1 v1.5, JSEncrypt).
+	Encryption  string
+	RSAModulus  string
+	RSAExponent string
+	PublicKey   string
+	MD5Salt     string // Prepended to the password before hashing
+}
+
+var defaultNames = ParamNames{
+	Callback:     "callback",
+	Account:      "user_account",
+	Password:     "user_password",
+	IP:           "wlan_user_ip",
+	IPv6:         "wlan_user_ipv6",
+	MAC:          "wlan_user_mac",
+	Encrypt:      "encrypt",
+	LoginMethod:  "login_method",
+	JSVersion:    "jsVersion",
+	TerminalType: "terminal_type",
+	Lang:         "lang",
+	IsLogin:      "is_login",
+}
+
+// DefaultProfile matches the ePortal build this tool was written against.
+// The odd ",`," account prefix (%2C%60%2C) comes from a captured login.
+var DefaultProfile = Profile{
+	Name:            "default",
+	LoginPath:       "/eportal/portal/login",
+	LogoutPath:      "/eportal/portal/logout",
+	StatusPath:      "/eportal/portal/custom/loadUserInfo",
+	AccountTemplate: ",`,{account}",
+	Names:           defaultNames,
+	LoginMethod:     "1",
+	JSVersion:       "4.2.1",
+	TerminalType:    "1",
+	Lang:            "zh-cn",
+	IsLogin:         "0",
+	Callback:        CallbackRandom,
+	// Logout takes the bare account and status lang=zh
+	LogoutAccountTemplate: "{account}",
+	StatusLang:            "zh",
+}
+
+// Presets are the built-in named profiles selectable via portal.preset.
+var Presets = map[string]Profile{
+	"default": DefaultProfile,
+	"pc": DefaultProfile.Merge(Profile{
+		Name:            "pc",
+		AccountTemplate: ",0,{account}",
+	}),
+	"mobile": DefaultProfile.Merge(Profile{
+		Name:            "mobile",
+		AccountTemplate: ",1,{account}",
+		TerminalType:    "2",
+	}),
+	"plain": DefaultProfile.Merge(Profile{
+		Name:            "plain",
+		AccountTemplate: "{account}",
+	}),
+}
+
+// LookupProfile returns a built-in preset by name.
+func LookupProfile(name string) (Profile, error) {
+	if name == "" {
+		return DefaultProfile, nil
+	}
+	p, ok := Presets[name]
+	if !ok {
+		names := make([]string, 0, len(Presets))
+		for n := range Presets {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("unknown portal preset %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// Merge returns a copy of p with every non-empty field of o applied on top.
+// Fields and Extra entries of o set to Unset are cleared in the result.
+func (p Profile) Merge(o Profile) Profile {
+	set := func(dst *string, v string) {
+		switch v {
+		case "":
+		case Unset:
+			*dst = ""
+		default:
+			*dst = v
+		}
+	}
+	set(&p.Name, o.Name)
+	set(&p.LoginPath, o.LoginPath)
+	set(&p.LogoutPath, o.LogoutPath)
+	set(&p.StatusPath, o.StatusPath)
+	set(&p.AccountTemplate, o.AccountTemplate)
+	set(&p.LogoutAccountTemplate, o.LogoutAccountTemplate)
+	set(&p.Names.Callback, o.Names.Callback)
+	set(&p.Names.Account, o.Names.Account)
+	set(&p.Names.Password, o.Names.Password)
+	set(&p.Names.IP, o.Names.IP)
+	set(&p.Names.IPv6, o.Names.IPv6)
+	set(&p.Names.MAC, o.Names.MAC)
+	set(&p.Names.Encrypt, o.Names.Encrypt)
+	set(&p.Names.LoginMethod, o.Names.LoginMethod)
+	set(&p.Names.JSVersion, o.Names.JSVersion)
+	set(&p.Names.TerminalType, o.Names.TerminalType)
+	set(&p.Names.Lang, o.Names.Lang)
+	set(&p.Names.IsLogin, o.Names.IsLogin)
+	set(&p.LoginMethod, o.LoginMethod)
+	set(&p.JSVersion, o.JSVersion)
+	set(&p.TerminalType, o.TerminalType)
+	set(&p.Lang, o.Lang)
+	set(&p.StatusLang, o.StatusLang)
+	set(&p.IsLogin, o.IsLogin)
+	set(&p.Callback, o.Callback)
+	set(&p.CallbackName, o.CallbackName)
+	set(&p.Encryption, o.Encryption)
+	set(&p.RSAModulus, o.RSAModulus)
+	set(&p.RSAExponent, o.RSAExponent)
+	set(&p.PublicKey, o.PublicKey)
+	set(&p.MD5Salt, o.MD5Salt)
+	if len(o.Extra) > 0 {
+		extra := make(map[string]string, len(p.Extra)+len(o.Extra))
+		for k, v := range p.Extra {
+			extra[k] = v
+		}
+		for k, v := range o.Extra {
+			if v == Unset {
+				delete(extra, k)
+			} else {
+				extra[k] = v
+			}
+		}
+		p.Extra = extra
+	}
+	return p
+}
+
+// Account renders the login account from the template.
+func (p Profile) Account(username string) string {
+	return renderAccount(p.AccountTemplate, username)
+}
+
+// LogoutAccount renders the logout account from its template.
+func (p Profile) LogoutAccount(username string) string {
+	return renderAccount(p.LogoutAccountTemplate, username)
+}
+
+func renderAccount(template, username string) string {
+	if template == "" {
+		return username
+	}
+	return strings.ReplaceAll(template, "{account}", username)
+}
+
+// setParam sets a request parameter unless its name was unset.
+func setParam(params url.Values, name, value string) {
+	if name != "" {
+		params.Set(name, value)
+	}
+}
+
+// callback returns the callback value to send, or "" to omit it.
+func (p Profile) callback() string {
+	switch p.Callback {
+	case CallbackNone:
+		return ""
+	case CallbackFixed:
+		if p.CallbackName != "" {
+			return p.CallbackName
+		}
+	}
+	return fmt.Sprintf("dr%d", 1000+rand.Intn(9000))
+}
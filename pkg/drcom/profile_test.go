@@ -0,0 +1,80 @@
+package drcom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProfileMergeUnset(t *testing.T) {
+	base := DefaultProfile.Merge(Profile{Extra: map[string]string{"a": "1", "b": "2"}})
+	p := base.Merge(Profile{
+		Lang:    "en",
+		Names:   ParamNames{Lang: Unset, IsLogin: "online"},
+		IsLogin: "1",
+		Extra:   map[string]string{"a": Unset, "c": "3"},
+		MD5Salt: Unset,
+	})
+	if p.Lang != "en" || p.Names.Lang != "" || p.Names.IsLogin != "online" || p.IsLogin != "1" {
+		t.Fatalf("merged %+v", p)
+	}
+	if fmt.Sprint(p.Extra) != "map[b:2 c:3]" {
+		t.Fatalf("extra %v", p.Extra)
+	}
+	// The base profile is not modified.
+	if base.Names.Lang != "lang" || base.Extra["a"] != "1" {
+		t.Fatalf("base changed: %+v", base)
+	}
+}
+
+func TestProfileRequests(t *testing.T) {
+	got := map[string]url.Values{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got[r.URL.Path] = r.URL.Query()
+		fmt.Fprintf(w, `%s({"result":1,"msg":"ok"})`, r.URL.Query().Get("callback"))
+	}))
+	defer srv.Close()
+
+	profile := Presets["pc"].Merge(Profile{
+		Lang:    "en",
+		IsLogin: "1",
+		Names:   ParamNames{TerminalType: Unset},
+	})
+	c := NewClient(srv.URL, "student", "secret", WithProfile(profile), WithIP("10.0.0.2"))
+	ctx := context.Background()
+	if _, err := c.LoginContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LogoutContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.GetStatusContext(ctx)
+
+	login := got[profile.LoginPath]
+	if login.Get("user_account") != ",0,student" || login.Get("lang") != "en" || login.Has("terminal_type") || login.Has("") {
+		t.Errorf("login %v", login)
+	}
+	// Logout sends the bare account and status its own lang.
+	if logout := got[profile.LogoutPath]; logout.Get("user_account") != "student" {
+		t.Errorf("logout %v", logout)
+	}
+	if status := got[profile.StatusPath]; status.Get("is_login") != "1" || status.Get("lang") != "zh" {
+		t.Errorf("status %v", status)
+	}
+
+	c = NewClient(srv.URL, "student", "secret", WithIP("10.0.0.2"),
+		WithProfile(profile.Merge(Profile{LogoutAccountTemplate: ",0,{account}", StatusLang: "en"})))
+	if err := c.LogoutContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.GetStatusContext(ctx)
+	if logout := got[profile.LogoutPath]; logout.Get("user_account") != ",0,student" {
+		t.Errorf("templated logout %v", logout)
+	}
+	if status := got[profile.StatusPath]; status.Get("lang") != "en" {
+		t.Errorf("status lang %v", status)
+	}
+}
@@ -0,0 +1,315 @@
+package drcom
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net"
+	"sync"
+	"time"
+)
+
+// DriverPVersion is the Dr.COM P-version heartbeat that has to accompany a
+// PPPoE session. Authentication itself is done by pppd; this driver only
+// keeps the session from being dropped.
+const DriverPVersion = "drcom-p"
+
+func init() {
+	RegisterDriver(DriverPVersion, func(cfg DriverConfig) (PortalDriver, error) {
+		pc, err := NewPConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewPClient(pc), nil
+	})
+}
+
+// PConfig holds the P-version heartbeat parameters.
+type PConfig struct {
+	Server    string // host:port of the authentication server
+	Interface string // PPPoE interface to bind to, e.g. ppp0
+	Username  string
+	MAC       net.HardwareAddr
+
+	KeepAliveVersion []byte // 2 bytes, e.g. dc02
+
+	KeepAliveInterval time.Duration
+	Timeout           time.Duration
+}
+
+// NewPConfig reads a PConfig from the driver settings: server, interface,
+// mac, keep_alive_version and keep_alive_interval (seconds).
+func NewPConfig(cfg DriverConfig) (PConfig, error) {
+	s := cfg.Settings
+	pc := PConfig{
+		Server:    udpServerAddr(s.String("server", cfg.Host)),
+		Interface: s.String("interface", cfg.Interface),
+		Username:  cfg.Username,
+		Timeout:   3 * time.Second,
+	}
+	if pc.Interface == "" {
+		pc.Interface = "ppp0"
+	}
+	s = s.withDefaults(map[string]string{"mac": cfg.MAC})
+	var err error
+	if pc.MAC, err = s.MAC("mac"); err != nil {
+		return pc, err
+	}
+	if pc.KeepAliveVersion, err = s.Hex("keep_alive_version", []byte{0xdc, 0x02}); err != nil {
+		return pc, err
+	}
+	if len(pc.KeepAliveVersion) != 2 {
+		return pc, errors.New("keep_alive_version must be 2 bytes")
+	}
+	if pc.KeepAliveInterval, err = s.Seconds("keep_alive_interval", 20*time.Second); err != nil {
+		return pc, err
+	}
+	return pc, nil
+}
+
+// PClient runs the P-version heartbeat: a 0x07/0x08 challenge, a 96-byte
+// 0x07/0x60 heartbeat and the 0x07/0x28 keep-alive pair also used by the
+// D version.
+type PClient struct {
+	cfg PConfig
+	udp udpSession
+
+	mu       sync.Mutex
+	count    byte
+	sourceIP net.IP
+	active   bool
+	since    time.Time
+}
+
+func NewPClient(cfg PConfig) *PClient {
+	return &PClient{
+		cfg: cfg,
+		udp: udpSession{
+			server:  cfg.Server,
+			iface:   cfg.Interface,
+			timeout: cfg.Timeout,
+		},
+	}
+}
+
+// challenge returns the 4-byte seed and the source IP seen by the server.
+func (p *PClient) challenge(ctx context.Context) (seed []byte, src net.IP, err error) {
+	pkt := []byte{0x07, p.count, 0x08, 0x00, 0x01, 0x00, 0x00, 0x00}
+	p.count++
+	resp, err := p.udp.exchange(ctx, pkt, func(b []byte) bool { return len(b) >= 16 && b[0] == 0x07 })
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp[8:12], net.IP(append([]byte(nil), resp[12:16]...)), nil
+}
+
+// Login only checks that the heartbeat server answers; pppd has already
+// authenticated the link.
+func (p *PClient) Login(ctx context.Context) (*LoginResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, src, err := p.challenge(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.cfg.MAC == nil {
+		p.cfg.MAC = macForIP(p.udp.local())
+	}
+	p.sourceIP = src
+	p.active = true
+	p.since = time.Now()
+	return &LoginResult{Outcome: OutcomeSuccess, Message: "PPPoE 心跳已就绪"}, nil
+}
+
+// Logout stops the heartbeat; the PPPoE link itself is left to pppd.
+func (p *PClient) Logout(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.udp.close()
+	if !p.active {
+		return ErrNotLocalSession
+	}
+	p.active = false
+	return nil
+}
+
+func (p *PClient) Status(ctx context.Context) (*AccountStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := &AccountStatus{Username: p.cfg.Username, Host: p.cfg.Server, LoggedIn: p.active}
+	if p.sourceIP != nil {
+		st.IP = p.sourceIP.String()
+	}
+	if !p.active {
+		return st, fmt.Errorf("%w: %w", ErrNoStatusData, ErrNotLocalSession)
+	}
+	st.OnlineSeconds = int64(time.Since(p.since).Seconds())
+	return st, nil
+}
+
+func (p *PClient) Probe(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, _, err := p.challenge(ctx)
+	return err
+}
+
+func (p *PClient) KeepAlive(ctx context.Context) error {
+	first := true
+	var num byte
+	tail := make([]byte, 4)
+	isReply := func(b []byte) bool { return len(b) >= 20 && b[0] == 0x07 }
+
+	for {
+		p.mu.Lock()
+		if !p.active {
+			p.mu.Unlock()
+			return ErrSessionLost
+		}
+		err := func() error {
+			seed, src, err := p.challenge(ctx)
+			if err != nil {
+				return err
+			}
+			p.sourceIP = src
+			if _, err := p.udp.exchange(ctx, p.heartbeatPacket(seed, first), isReply); err != nil {
+				return err
+			}
+			for _, typ := range []byte{1, 3} {
+				resp, err := p.udp.exchange(ctx, keepAlive2Packet(num, tail, typ, first, p.cfg.KeepAliveVersion, p.sourceIP), isReply)
+				if err != nil {
+					return err
+				}
+				copy(tail, resp[16:20])
+				num++
+			}
+			return nil
+		}()
+		p.mu.Unlock()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: %v", ErrSessionLost, err)
+		}
+		first = false
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.cfg.KeepAliveInterval):
+		}
+	}
+}
+
+// heartbeatPacket lays out the 96-byte heartbeat:
+//
+//	0      0x07
+//	1      counter
+//	2-3    0x60 0x00 (length)
+//	4-5    0x03 0x00 (type)
+//	6-11   MAC
+//	12-15  source IP from the challenge
+//	16-19  0x00 0x62 0x00 flag (0x2a first, 0x6a afterwards)
+//	20-23  challenge seed
+//	24-31  checksum, computed with this field zeroed
+//	32-95  zero
+func (p *PClient) heartbeatPacket(seed []byte, first bool) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0x07, p.count, 0x60, 0x00, 0x03, 0x00})
+	p.count++
+	b.Write(macBytes(p.cfg.MAC))
+	b.Write(ip4(p.sourceIP))
+	flag := byte(0x6a)
+	if first {
+		flag = 0x2a
+	}
+	b.Write([]byte{0x00, 0x62, 0x00, flag})
+	b.Write(seed)
+	b.Write(make([]byte, 8))
+	b.Write(make([]byte, 64))
+	pkt := b.Bytes()
+	copy(pkt[24:32], pChecksum(pkt, seed))
+	return pkt
+}
+
+// pChecksum picks the checksum algorithm from the low two bits of the seed:
+// 0 fixed constants, 1 MD5, 2 MD4, 3 SHA1, each picking 8 digest bytes.
+func pChecksum(pkt, seed []byte) []byte {
+	pick := func(sum []byte, idx ...int) []byte {
+		out := make([]byte, 0, len(idx))
+		for _, i := range idx {
+			out = append(out, sum[i])
+		}
+		return out
+	}
+	switch binary.LittleEndian.Uint32(seed) & 3 {
+	case 1:
+		return pick(md5sum(pkt), 2, 3, 8, 9, 5, 6, 13, 14)
+	case 2:
+		return pick(md4sum(pkt), 1, 2, 8, 9, 4, 5, 11, 12)
+	case 3:
+		sum := sha1.Sum(pkt)
+		return pick(sum[:], 2, 3, 9, 10, 5, 6, 15, 16)
+	default:
+		out := make([]byte, 8)
+		binary.LittleEndian.PutUint32(out[0:4], 20000711)
+		binary.LittleEndian.PutUint32(out[4:8], 126)
+		return out
+	}
+}
+
+// md4sum implements RFC 1320; only needed for the heartbeat checksum.
+func md4sum(data []byte) []byte {
+	msg := append([]byte(nil), data...)
+	msg = append(msg, 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(len(data))*8)
+
+	h := [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+	order2 := [16]int{0, 4, 8, 12, 1, 5, 9, 13, 2, 6, 10, 14, 3, 7, 11, 15}
+	order3 := [16]int{0, 8, 4, 12, 2, 10, 6, 14, 1, 9, 5, 13, 3, 11, 7, 15}
+	shifts := [3][4]int{{3, 7, 11, 19}, {3, 5, 9, 13}, {3, 9, 11, 15}}
+
+	for off := 0; off < len(msg); off += 64 {
+		var x [16]uint32
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[off+4*i:])
+		}
+		v := h
+		for round := 0; round < 3; round++ {
+			for i := 0; i < 16; i++ {
+				// Targets cycle a, d, c, b; the other three are the arguments.
+				t := (4 - i%4) % 4
+				b, c, d := v[(t+1)%4], v[(t+2)%4], v[(t+3)%4]
+				var f uint32
+				k := i
+				switch round {
+				case 0:
+					f = (b & c) | (^b & d)
+				case 1:
+					f = ((b & c) | (b & d) | (c & d)) + 0x5a827999
+					k = order2[i]
+				case 2:
+					f = (b ^ c ^ d) + 0x6ed9eba1
+					k = order3[i]
+				}
+				v[t] = bits.RotateLeft32(v[t]+f+x[k], shifts[round][i%4])
+			}
+		}
+		for i := range h {
+			h[i] += v[i]
+		}
+	}
+	out := make([]byte, 16)
+	for i, w := range h {
+		binary.LittleEndian.PutUint32(out[4*i:], w)
+	}
+	return out
+}
@@ -0,0 +1,266 @@
+package drcom
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// pServer is a stand-in P-version heartbeat server. Each challenge hands
+// out the next seed, so successive rounds use different checksums.
+type pServer struct {
+	t    *testing.T
+	conn *net.UDPConn
+
+	mac   net.HardwareAddr
+	srcIP net.IP
+	seeds [][]byte
+
+	count  byte   // Expected counter of the next 0x07/0x08 or 0x07/0x60 packet
+	seed   []byte // Seed of the current round
+	tail   []byte // Tail handed out with the last 0x07/0x28 reply
+	rounds chan string
+}
+
+func newPServer(t *testing.T) *pServer {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &pServer{
+		t:     t,
+		conn:  conn,
+		mac:   net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		srcIP: net.IPv4(10, 1, 2, 3).To4(),
+		// Low two bits select the checksum: 0 constants, 1 MD5, 2 MD4, 3 SHA1.
+		// The first seed goes to the login challenge.
+		seeds: [][]byte{
+			{0x10, 0x20, 0x30, 0x40},
+			{0x11, 0x22, 0x33, 0x44},
+			{0x13, 0x57, 0x9b, 0xdf},
+			{0x12, 0x34, 0x56, 0x78},
+			{0x24, 0x68, 0xac, 0xe0},
+		},
+		tail:   make([]byte, 4),
+		rounds: make(chan string, 16),
+	}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *pServer) client() *PClient {
+	return NewPClient(PConfig{
+		Server:            s.conn.LocalAddr().String(),
+		Username:          "student",
+		MAC:               s.mac,
+		KeepAliveVersion:  []byte{0xdc, 0x02},
+		KeepAliveInterval: 10 * time.Millisecond,
+		Timeout:           time.Second,
+	})
+}
+
+func (s *pServer) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		pkt := append([]byte(nil), buf[:n]...)
+		if pkt[0] != 0x07 || len(pkt) < 4 {
+			s.t.Errorf("unexpected packet % x", pkt)
+			continue
+		}
+		var reply []byte
+		switch pkt[2] {
+		case 0x08:
+			reply = s.challenge(pkt)
+		case 0x60:
+			reply = s.heartbeat(pkt)
+		case 0x28:
+			reply = s.keepAlive(pkt)
+		default:
+			s.t.Errorf("unexpected 0x07 packet % x", pkt)
+		}
+		if reply != nil {
+			s.conn.WriteToUDP(reply, addr)
+		}
+	}
+}
+
+func (s *pServer) checkCount(what string, pkt []byte) {
+	if pkt[1] != s.count {
+		s.t.Errorf("%s: counter %d, want %d", what, pkt[1], s.count)
+	}
+	s.count = pkt[1] + 1
+}
+
+func (s *pServer) challenge(pkt []byte) []byte {
+	if !bytes.Equal(pkt, []byte{0x07, pkt[1], 0x08, 0x00, 0x01, 0x00, 0x00, 0x00}) {
+		s.t.Errorf("challenge: bad packet % x", pkt)
+	}
+	s.checkCount("challenge", pkt)
+	s.seed = s.seeds[0]
+	if len(s.seeds) > 1 {
+		s.seeds = s.seeds[1:]
+	}
+	reply := make([]byte, 32)
+	reply[0], reply[1], reply[2] = 0x07, pkt[1], 0x10
+	copy(reply[8:12], s.seed)
+	copy(reply[12:16], s.srcIP)
+	return reply
+}
+
+// heartbeat checks the 96-byte packet and recomputes its checksum.
+func (s *pServer) heartbeat(pkt []byte) []byte {
+	if len(pkt) != 96 {
+		s.t.Errorf("heartbeat: %d bytes, want 96", len(pkt))
+		return nil
+	}
+	s.checkCount("heartbeat", pkt)
+	if !bytes.Equal(pkt[2:6], []byte{0x60, 0x00, 0x03, 0x00}) {
+		s.t.Errorf("heartbeat: header % x", pkt[2:6])
+	}
+	if !bytes.Equal(pkt[6:12], s.mac) || !bytes.Equal(pkt[12:16], s.srcIP) || !bytes.Equal(pkt[20:24], s.seed) {
+		s.t.Errorf("heartbeat: MAC/IP/seed % x", pkt[6:24])
+	}
+	if !bytes.Equal(pkt[16:19], []byte{0x00, 0x62, 0x00}) || (pkt[19] != 0x2a && pkt[19] != 0x6a) {
+		s.t.Errorf("heartbeat: flag % x", pkt[16:20])
+	}
+	if !bytes.Equal(pkt[32:], make([]byte, 64)) {
+		s.t.Errorf("heartbeat: padding not zero")
+	}
+	zeroed := append([]byte(nil), pkt...)
+	copy(zeroed[24:32], make([]byte, 8))
+	var want []byte
+	pick := func(sum []byte, idx ...int) {
+		for _, i := range idx {
+			want = append(want, sum[i])
+		}
+	}
+	algo := "const"
+	switch s.seed[0] & 3 {
+	case 1:
+		sum := md5.Sum(zeroed)
+		pick(sum[:], 2, 3, 8, 9, 5, 6, 13, 14)
+		algo = "md5"
+	case 3:
+		sum := sha1.Sum(zeroed)
+		pick(sum[:], 2, 3, 9, 10, 5, 6, 15, 16)
+		algo = "sha1"
+	case 2:
+		// md4sum itself is checked against RFC 1320 in TestMD4.
+		pick(md4sum(zeroed), 1, 2, 8, 9, 4, 5, 11, 12)
+		algo = "md4"
+	case 0:
+		want = binary.LittleEndian.AppendUint32(want, 20000711)
+		want = binary.LittleEndian.AppendUint32(want, 126)
+	}
+	if !bytes.Equal(pkt[24:32], want) {
+		s.t.Errorf("heartbeat: %s checksum % x, want % x", algo, pkt[24:32], want)
+	}
+	s.rounds <- fmt.Sprintf("%s/%02x", algo, pkt[19])
+
+	reply := make([]byte, 32)
+	reply[0], reply[1], reply[2] = 0x07, pkt[1], 0x60
+	return reply
+}
+
+// keepAlive checks the 0x07/0x28 pair; the tail must be the one handed
+// out with the previous reply.
+func (s *pServer) keepAlive(pkt []byte) []byte {
+	if len(pkt) != 40 || pkt[4] != 0x0b {
+		s.t.Errorf("keep-alive: bad packet % x", pkt)
+		return nil
+	}
+	if !bytes.Equal(pkt[16:20], s.tail) {
+		s.t.Errorf("keep-alive %d/%d: tail % x, want % x", pkt[1], pkt[5], pkt[16:20], s.tail)
+	}
+	if pkt[5] == 3 && !bytes.Equal(pkt[28:32], s.srcIP) {
+		s.t.Errorf("keep-alive type 3: IP % x", pkt[28:32])
+	}
+	s.rounds <- fmt.Sprintf("07/%d/%d/%x", pkt[1], pkt[5], pkt[6:8])
+
+	s.tail = []byte{0xa0 | pkt[1], pkt[5], 0x55, 0xaa}
+	reply := make([]byte, 40)
+	reply[0], reply[1], reply[2] = 0x07, pkt[1], 0x28
+	copy(reply[16:20], s.tail)
+	return reply
+}
+
+func TestPClientKeepAlive(t *testing.T) {
+	s := newPServer(t)
+	p := s.client()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := p.Login(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := p.Status(ctx); err != nil || st.IP != "10.1.2.3" {
+		t.Fatalf("status %+v, %v", st, err)
+	}
+
+	kaCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- p.KeepAlive(kaCtx) }()
+
+	var seq []string
+	for len(seq) < 12 {
+		select {
+		case r := <-s.rounds:
+			seq = append(seq, r)
+		case err := <-done:
+			t.Fatalf("keep-alive stopped early: %v", err)
+		case <-ctx.Done():
+			t.Fatalf("keep-alive sequence %v incomplete", seq)
+		}
+	}
+	stop()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("keep-alive returned %v", err)
+	}
+	// One round per checksum algorithm. Only the first round has the 0x2a
+	// flag and version 0f27; the pair counter and tail carry across rounds.
+	want := []string{
+		"md5/2a", "07/0/1/0f27", "07/1/3/0f27",
+		"sha1/6a", "07/2/1/dc02", "07/3/3/dc02",
+		"md4/6a", "07/4/1/dc02", "07/5/3/dc02",
+		"const/6a", "07/6/1/dc02", "07/7/3/dc02",
+	}
+	if fmt.Sprint(seq) != fmt.Sprint(want) {
+		t.Fatalf("sequence %v, want %v", seq, want)
+	}
+
+	if err := p.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.KeepAlive(ctx); !errors.Is(err, ErrSessionLost) {
+		t.Fatalf("keep-alive after logout: %v", err)
+	}
+}
+
+func TestMD4(t *testing.T) {
+	// RFC 1320, appendix A.5.
+	tests := map[string]string{
+		"":               "31d6cfe0d16ae931b73c59d7e0c089c0",
+		"abc":            "a448017aaf21d8525fc10ae87aa6729d",
+		"message digest": "d9130a8164549fe818874806e1c7014b",
+		"12345678901234567890123456789012345678901234567890123456789012345678901234567890": "e33b4ddc9c38f2199c3e7b164fcc0536",
+	}
+	for in, want := range tests {
+		if got := hex.EncodeToString(md4sum([]byte(in))); got != want {
+			t.Errorf("md4(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
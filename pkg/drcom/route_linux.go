@@ -0,0 +1,105 @@
+//go:build linux
+
+package drcom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"strings"
+)
+
+// routeFor looks up the most specific IPv4 route for dst in
+// /proc/net/route and returns its interface and gateway (nil if on-link).
+func routeFor(dst net.IP) (string, net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	dst4 := dst.To4()
+	if dst4 == nil {
+		return "", nil, errNoRoute
+	}
+	var (
+		bestIface string
+		bestGW    net.IP
+		bestBits  = -1
+	)
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		dest, err1 := procIP(fields[1])
+		gw, err2 := procIP(fields[2])
+		mask, err3 := procIP(fields[7])
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		m := net.IPMask(mask)
+		if !dest.Equal(dst4.Mask(m)) {
+			continue
+		}
+		if bits, _ := m.Size(); bits > bestBits {
+			bestBits = bits
+			bestIface = fields[0]
+			bestGW = nil
+			if !gw.Equal(net.IPv4zero.To4()) {
+				bestGW = gw
+			}
+		}
+	}
+	if bestBits < 0 {
+		return "", nil, errNoRoute
+	}
+	return bestIface, bestGW, sc.Err()
+}
+
+// procIP decodes the little-endian hex addresses of /proc/net/route.
+func procIP(s string) (net.IP, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return nil, errNoRoute
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+	return ip, nil
+}
+
+// linkUp reports the carrier state from sysfs.
+func linkUp(ifname string) (bool, error) {
+	b, err := os.ReadFile("/sys/class/net/" + ifname + "/carrier")
+	if err != nil {
+		// Reading carrier fails with EINVAL while the interface is down.
+		if _, statErr := os.Stat("/sys/class/net/" + ifname); statErr == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	return strings.TrimSpace(string(b)) == "1", nil
+}
+
+// neighborKnown reports whether ip has a complete entry in the ARP table.
+func neighborKnown(ip net.IP) bool {
+	f, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		// IP address, HW type, Flags (0x2 = complete), HW address, ...
+		if len(fields) >= 4 && net.ParseIP(fields[0]).Equal(ip) && fields[2] != "0x0" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package drcom
+
+import "net"
+
+// routeFor is only implemented on Linux; other systems fall back to the
+// kernel's source address selection.
+func routeFor(dst net.IP) (string, net.IP, error) {
+	return "", nil, errNoRoute
+}
+
+// linkUp approximates the carrier with the interface flags.
+func linkUp(ifname string) (bool, error) {
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return false, err
+	}
+	return iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagRunning != 0, nil
+}
+
+// neighborKnown has no portable implementation; gateway checks rely on
+// connecting instead.
+func neighborKnown(ip net.IP) bool {
+	return false
+}
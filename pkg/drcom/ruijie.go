@@ -0,0 +1,218 @@
+package drcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DriverRuijie is the Ruijie ePortal (/eportal/InterFace.do).
+const DriverRuijie = "ruijie"
+
+func init() {
+	RegisterDriver(DriverRuijie, func(cfg DriverConfig) (PortalDriver, error) {
+		return NewRuijieDriver(NewClient(cfg.Host, cfg.Username, cfg.Password, cfg.Options...), cfg.Settings), nil
+	})
+}
+
+// RuijieDriver implements PortalDriver for Ruijie ePortal.
+type RuijieDriver struct {
+	Client   *DrComClient
+	Service  string // Optional operator/service name shown on the login page
+	ProbeURL string
+
+	mu          sync.Mutex
+	queryString string // Query of the captive redirect, required by login
+	pinnedQuery bool   // queryString came from the settings
+	userIndex   string
+}
+
+// NewRuijieDriver reads the service, probe_url and query_string settings.
+// Without query_string the query is captured from the captive redirect.
+func NewRuijieDriver(c *DrComClient, s Settings) *RuijieDriver {
+	qs := s.String("query_string", "")
+	return &RuijieDriver{
+		Client:      c,
+		Service:     s.String("service", ""),
+		ProbeURL:    s.String("probe_url", DefaultProbeURL),
+		queryString: qs,
+		pinnedQuery: qs != "",
+	}
+}
+
+type ruijieResponse struct {
+	Result    string `json:"result"`
+	Message   string `json:"message"`
+	UserIndex string `json:"userIndex"`
+	UserName  string `json:"userName"`
+	UserID    string `json:"userId"`
+	UserIP    string `json:"userIp"`
+}
+
+// captureQueryString follows the captive redirect to the login page and
+// keeps its query string. Once online there is no redirect, so an already
+// captured value is kept.
+func (d *RuijieDriver) captureQueryString(ctx context.Context) (string, error) {
+	if d.queryString != "" {
+		return d.queryString, nil
+	}
+	info, err := d.Client.discover(ctx, d.ProbeURL)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(info.LoginURL)
+	if err != nil {
+		return "", err
+	}
+	d.Client.mu.Lock()
+	if d.Client.Host == "" {
+		d.Client.Host = u.Scheme + "://" + u.Host
+	}
+	d.Client.mu.Unlock()
+	d.queryString = u.RawQuery
+	return d.queryString, nil
+}
+
+func (d *RuijieDriver) call(ctx context.Context, method string, form url.Values) (*ruijieResponse, error) {
+	body, err := d.Client.send(ctx, "POST", d.Client.host()+"/eportal/InterFace.do?method="+method, form)
+	if err != nil {
+		return nil, err
+	}
+	var res ruijieResponse
+	if err := parseJSONP(body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (d *RuijieDriver) Login(ctx context.Context) (*LoginResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	qs, err := d.captureQueryString(ctx)
+	if errors.Is(err, errNoRedirect) {
+		// Nothing intercepted the probe, so this address is already
+		// online; pick up its userIndex for a later logout.
+		if d.Client.host() != "" {
+			d.onlineUserInfo(ctx)
+		}
+		return &LoginResult{Outcome: OutcomeAlreadyOnline, Message: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("userId", d.Client.Username)
+	form.Set("password", d.Client.Password)
+	form.Set("service", d.Service)
+	// The page script sends the query URL-encoded once more.
+	form.Set("queryString", url.QueryEscape(qs))
+	form.Set("operatorPwd", "")
+	form.Set("operatorUserId", "")
+	form.Set("validcode", "")
+	form.Set("passwordEncrypt", "false")
+	res, err := d.call(ctx, "login", form)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &LoginResult{Message: res.Message, Code: res.Result, Raw: res}
+	if res.Result == "success" {
+		d.userIndex = res.UserIndex
+		r.Outcome = OutcomeSuccess
+		return r, nil
+	}
+	r.Outcome = d.Client.classifier.Match(res.Result, res.Message)
+	return r, nil
+}
+
+func (d *RuijieDriver) Logout(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.userIndex == "" {
+		// Logged in by another process; look the session up by address.
+		if _, err := d.onlineUserInfo(ctx); err != nil {
+			return err
+		}
+		if d.userIndex == "" {
+			return fmt.Errorf("logout failed: no online session for %s", d.Client.GetLocalIP())
+		}
+	}
+	form := url.Values{}
+	form.Set("userIndex", d.userIndex)
+	res, err := d.call(ctx, "logout", form)
+	if err != nil {
+		return err
+	}
+	if res.Result != "success" {
+		return fmt.Errorf("logout failed: %s", res.Message)
+	}
+	d.userIndex = ""
+	return nil
+}
+
+// Status uses getOnlineUserInfo. Without a userIndex from this process the
+// portal looks the session up by source address.
+func (d *RuijieDriver) Status(ctx context.Context) (*AccountStatus, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	res, err := d.onlineUserInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st := &AccountStatus{Username: d.Client.Username, IP: d.Client.GetLocalIP(), Host: d.Client.host(), Raw: res}
+	if res.Result != "success" {
+		return st, ErrNoStatusData
+	}
+	st.LoggedIn = true
+	if name := strings.TrimSpace(res.UserID); name != "" {
+		st.Username = name
+	}
+	if res.UserIP != "" {
+		st.IP = res.UserIP
+	}
+	return st, nil
+}
+
+// onlineUserInfo calls getOnlineUserInfo and keeps the userIndex it
+// returns. The caller holds d.mu.
+func (d *RuijieDriver) onlineUserInfo(ctx context.Context) (*ruijieResponse, error) {
+	form := url.Values{}
+	form.Set("userIndex", d.userIndex)
+	res, err := d.call(ctx, "getOnlineUserInfo", form)
+	if err != nil {
+		return nil, err
+	}
+	if res.Result == "success" && res.UserIndex != "" {
+		d.userIndex = res.UserIndex
+	}
+	return res, nil
+}
+
+func (d *RuijieDriver) Probe(ctx context.Context) error {
+	return NewEPortalDriver(d.Client).Probe(ctx)
+}
+
+func (d *RuijieDriver) Hosts() []HostHealth {
+	return d.Client.Hosts()
+}
+
+func (d *RuijieDriver) AddressChange() *AddressChange {
+	return d.Client.AddressChange()
+}
+
+// Handover also drops a captured queryString, which names the old address.
+func (d *RuijieDriver) Handover(ctx context.Context, ch *AddressChange) error {
+	err := handover(ctx, d, d.Client, ch)
+	d.mu.Lock()
+	if !d.pinnedQuery {
+		d.queryString = ""
+	}
+	d.mu.Unlock()
+	return err
+}
@@ -0,0 +1,179 @@
+package drcom
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const ruijieQuery = "wlanuserip=10.0.0.2&wlanacname=AC1&nasip=10.0.0.1"
+
+// ruijieServer is a stand-in Ruijie portal. The captive probe redirects to
+// the login page while the client is offline and answers 204 once online.
+type ruijieServer struct {
+	t       *testing.T
+	online  bool
+	logouts []string // userIndex of each logout
+}
+
+func (s *ruijieServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/generate_204" {
+		if s.online {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Redirect(w, r, "/eportal/index.jsp?"+ruijieQuery, http.StatusFound)
+		return
+	}
+	if r.URL.Path != "/eportal/InterFace.do" {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.t.Errorf("form: %v", err)
+	}
+	var res ruijieResponse
+	switch r.URL.Query().Get("method") {
+	case "login":
+		if qs := r.PostForm.Get("queryString"); qs != url.QueryEscape(ruijieQuery) {
+			s.t.Errorf("queryString %q", qs)
+		}
+		if r.PostForm.Get("password") != "secret" {
+			res = ruijieResponse{Result: "fail", Message: "密码错误"}
+			break
+		}
+		s.online = true
+		res = ruijieResponse{Result: "success", UserIndex: "idx-1"}
+	case "getOnlineUserInfo":
+		if !s.online {
+			res = ruijieResponse{Result: "fail", Message: "用户不在线"}
+			break
+		}
+		res = ruijieResponse{Result: "success", UserIndex: "idx-1", UserID: "student", UserIP: "10.0.0.2"}
+	case "logout":
+		s.logouts = append(s.logouts, r.PostForm.Get("userIndex"))
+		if r.PostForm.Get("userIndex") != "idx-1" {
+			res = ruijieResponse{Result: "fail", Message: "userIndex错误"}
+			break
+		}
+		s.online = false
+		res = ruijieResponse{Result: "success"}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func newRuijieTest(t *testing.T, online bool) (*ruijieServer, *httptest.Server) {
+	s := &ruijieServer{t: t, online: online}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func ruijieDriver(srv *httptest.Server, host, password string) *RuijieDriver {
+	c := NewClient(host, "student", password, WithIP("10.0.0.2"))
+	return NewRuijieDriver(c, Settings{"probe_url": srv.URL + "/generate_204"})
+}
+
+func TestRuijieLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		online   bool
+		host     bool // Host configured rather than taken from the redirect
+		password string
+		want     LoginOutcome
+		index    string
+	}{
+		{"success", false, false, "secret", OutcomeSuccess, "idx-1"},
+		{"wrong password", false, false, "wrong", OutcomeWrongPassword, ""},
+		{"already online", true, true, "secret", OutcomeAlreadyOnline, "idx-1"},
+		{"already online, host unknown", true, false, "secret", OutcomeAlreadyOnline, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, srv := newRuijieTest(t, tt.online)
+			host := ""
+			if tt.host {
+				host = srv.URL
+			}
+			d := ruijieDriver(srv, host, tt.password)
+			r, err := d.Login(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Outcome != tt.want || d.userIndex != tt.index {
+				t.Fatalf("outcome %v, userIndex %q; want %v, %q", r.Outcome, d.userIndex, tt.want, tt.index)
+			}
+			if !tt.online && d.Client.host() != srv.URL {
+				t.Fatalf("host %q not taken from the redirect", d.Client.host())
+			}
+		})
+	}
+}
+
+func TestRuijieLogout(t *testing.T) {
+	t.Run("after login", func(t *testing.T) {
+		s, srv := newRuijieTest(t, false)
+		d := ruijieDriver(srv, "", "secret")
+		if _, err := d.Login(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Logout(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(s.logouts) != 1 || s.online || d.userIndex != "" {
+			t.Fatalf("logouts %q, online %v", s.logouts, s.online)
+		}
+	})
+	t.Run("other process", func(t *testing.T) {
+		// A fresh driver looks the session up before logging out.
+		s, srv := newRuijieTest(t, true)
+		if err := ruijieDriver(srv, srv.URL, "secret").Logout(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(s.logouts) != 1 || s.logouts[0] != "idx-1" || s.online {
+			t.Fatalf("logouts %q, online %v", s.logouts, s.online)
+		}
+	})
+	t.Run("not online", func(t *testing.T) {
+		s, srv := newRuijieTest(t, false)
+		if err := ruijieDriver(srv, srv.URL, "secret").Logout(context.Background()); err == nil {
+			t.Fatal("logout succeeded without a session")
+		}
+		if len(s.logouts) != 0 {
+			t.Fatalf("logout sent without a userIndex: %q", s.logouts)
+		}
+	})
+}
+
+func TestRuijieStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		online bool
+		err    error
+	}{
+		{"online", true, nil},
+		{"offline", false, ErrNoStatusData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, srv := newRuijieTest(t, tt.online)
+			d := ruijieDriver(srv, srv.URL, "secret")
+			st, err := d.Status(context.Background())
+			if err != tt.err {
+				t.Fatalf("err %v, want %v", err, tt.err)
+			}
+			if st.LoggedIn != tt.online || st.Username != "student" || st.IP != "10.0.0.2" {
+				t.Fatalf("status %+v", st)
+			}
+			if tt.online && d.userIndex != "idx-1" {
+				t.Fatalf("userIndex %q not kept", d.userIndex)
+			}
+		})
+	}
+}
@@ -9,15 +9,28 @@ type ApiResponse struct {
 
 // Status Data Structure for API
 type ApiStatusData struct {
-	Success  bool    `json:"success"`
-	Username string  `json:"username"`
-	FlowGB   float64 `json:"flow_gb"`
-	Fee      float64 `json:"fee"`
-	IP       string  `json:"ip"`
-    Message  string  `json:"message,omitempty"`
+	Success       bool    `json:"success"`
+	Username      string  `json:"username"`
+	FlowGB        float64 `json:"flow_gb"`
+	UsedBytes     int64   `json:"used_bytes"`
+	Fee           float64 `json:"fee"`
+	OnlineSeconds int64   `json:"online_seconds"`
+	IP            string  `json:"ip"`
+	IPv6          string  `json:"ipv6,omitempty"`
+	Interface     string  `json:"interface,omitempty"`
+	Host          string  `json:"host,omitempty"`
+	Message       string  `json:"message,omitempty"`
+	// Set while the daemon has stopped logging in after a permanent failure
+	Paused *PauseState `json:"paused,omitempty"`
+}
+
+// Login Data Structure for API
+type ApiLoginData struct {
+	Outcome  LoginOutcome `json:"outcome"`
+	Response interface{}  `json:"response"`
 }
 
 type LoginRequest struct {
-    Username string `json:"username"`
-    Password string `json:"password"`
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
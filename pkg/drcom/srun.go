@@ -0,0 +1,313 @@
+package drcom
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+)
+
+// DriverSrun is the Srun (深澜) portal: get_challenge, then srun_portal with
+// an xEncode-encrypted info blob, HMAC-MD5 password and SHA1 checksum.
+const DriverSrun = "srun"
+
+func init() {
+	RegisterDriver(DriverSrun, func(cfg DriverConfig) (PortalDriver, error) {
+		return NewSrunDriver(NewClient(cfg.Host, cfg.Username, cfg.Password, cfg.Options...), cfg.Settings), nil
+	})
+}
+
+// srunAlphabet is the shuffled base64 alphabet used by the portal JS.
+const srunAlphabet = "LVoJPiCN2R8G90yg+hmFHuacZ1OWMnrsSTXkYpUq/3dlbfKwv6xztjI7DeBE45QA"
+
+var srunBase64 = base64.NewEncoding(srunAlphabet)
+
+// srunOutcomeRules maps Srun error codes and messages.
+var srunOutcomeRules = []OutcomeRule{
+	{Msg: "ip_already_online_error", Outcome: OutcomeAlreadyOnline},
+	{Msg: "E2620", Outcome: OutcomeAlreadyOnline},
+	{Msg: "E2531", Outcome: OutcomeWrongPassword},
+	{Msg: "E2553", Outcome: OutcomeWrongPassword},
+	{Msg: "E2901", Outcome: OutcomeWrongPassword},
+	{Msg: "password_error", Outcome: OutcomeWrongPassword},
+	{Msg: "E2616", Outcome: OutcomeAccountArrears},
+	{Msg: "E3001", Outcome: OutcomeAccountArrears},
+	{Msg: "E2606", Outcome: OutcomeAccountDisabled},
+	{Msg: "E2532", Outcome: OutcomeRateLimited},
+	{Msg: "E2833", Outcome: OutcomeTooManyDevices},
+}
+
+// SrunDriver implements PortalDriver for Srun portals.
+type SrunDriver struct {
+	Client *DrComClient
+	ACID   string // ac_id, found in the portal URL (index_1.html -> 1)
+	N      string
+	Type   string
+	OS     string
+	Name   string
+
+	classifier *Classifier
+}
+
+// NewSrunDriver reads the ac_id, n, type, os and name settings.
+func NewSrunDriver(c *DrComClient, s Settings) *SrunDriver {
+	return &SrunDriver{
+		Client:     c,
+		ACID:       s.String("ac_id", "1"),
+		N:          s.String("n", "200"),
+		Type:       s.String("type", "1"),
+		OS:         s.String("os", "Windows 10"),
+		Name:       s.String("name", "Windows"),
+		classifier: NewClassifier(append(append([]OutcomeRule(nil), srunOutcomeRules...), c.classifier.rules...)...),
+	}
+}
+
+// srunResponse covers get_challenge, srun_portal and rad_user_info answers.
+type srunResponse struct {
+	Challenge string      `json:"challenge"`
+	ClientIP  string      `json:"client_ip"`
+	Error     string      `json:"error"`
+	ErrorMsg  string      `json:"error_msg"`
+	Res       string      `json:"res"`
+	SucMsg    string      `json:"suc_msg"`
+	Ecode     interface{} `json:"ecode"`
+
+	OnlineIP    string      `json:"online_ip"`
+	UserName    string      `json:"user_name"`
+	SumBytes    json.Number `json:"sum_bytes"`
+	SumSeconds  json.Number `json:"sum_seconds"`
+	UserBalance json.Number `json:"user_balance"`
+}
+
+func (d *SrunDriver) get(ctx context.Context, path string, params url.Values) (*srunResponse, error) {
+	params.Set("callback", fmt.Sprintf("jQuery%d", 100000+rand.Intn(900000)))
+	params.Set("_", strconv.FormatInt(d.Client.now().UnixMilli(), 10))
+	body, err := d.Client.doRequest(ctx, d.Client.host()+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var res srunResponse
+	if err := parseJSONP(body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (d *SrunDriver) challenge(ctx context.Context) (token, ip string, err error) {
+	params := url.Values{}
+	params.Set("username", d.Client.Username)
+	params.Set("ip", d.Client.GetLocalIP())
+	res, err := d.get(ctx, "/cgi-bin/get_challenge", params)
+	if err != nil {
+		return "", "", err
+	}
+	if res.Challenge == "" {
+		return "", "", fmt.Errorf("get_challenge failed: %s %s", res.Error, res.ErrorMsg)
+	}
+	ip = res.ClientIP
+	if ip == "" {
+		ip = d.Client.GetLocalIP()
+	}
+	return res.Challenge, ip, nil
+}
+
+func (d *SrunDriver) Login(ctx context.Context) (*LoginResult, error) {
+	c := d.Client
+	token, ip, err := d.challenge(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := srunInfo(c.Username, c.Password, ip, d.ACID, token)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(md5.New, []byte(token))
+	mac.Write([]byte(c.Password))
+	hmd5 := hex.EncodeToString(mac.Sum(nil))
+
+	chk := token + c.Username + token + hmd5 + token + d.ACID + token + ip +
+		token + d.N + token + d.Type + token + info
+	sum := sha1.Sum([]byte(chk))
+
+	params := url.Values{}
+	params.Set("action", "login")
+	params.Set("username", c.Username)
+	params.Set("password", "{MD5}"+hmd5)
+	params.Set("ac_id", d.ACID)
+	params.Set("ip", ip)
+	params.Set("chksum", hex.EncodeToString(sum[:]))
+	params.Set("info", info)
+	params.Set("n", d.N)
+	params.Set("type", d.Type)
+	params.Set("os", d.OS)
+	params.Set("name", d.Name)
+	params.Set("double_stack", "0")
+	if c.ipMode == DualStack {
+		params.Set("double_stack", "1")
+	}
+	res, err := d.get(ctx, "/cgi-bin/srun_portal", params)
+	if err != nil {
+		return nil, err
+	}
+	return d.result(res), nil
+}
+
+func (d *SrunDriver) result(res *srunResponse) *LoginResult {
+	r := &LoginResult{Code: anyString(res.Ecode), Raw: res}
+	r.Message = res.ErrorMsg
+	if r.Message == "" {
+		r.Message = res.SucMsg
+	}
+	if res.Error == "ok" || res.Res == "ok" {
+		r.Outcome = OutcomeSuccess
+		if res.SucMsg == "ip_already_online_error" {
+			r.Outcome = OutcomeAlreadyOnline
+		}
+		return r
+	}
+	r.Outcome = d.classifier.Match(r.Code, res.Error+" "+res.ErrorMsg)
+	if r.Message == "" {
+		r.Message = res.Error
+	}
+	return r
+}
+
+func (d *SrunDriver) Logout(ctx context.Context) error {
+	params := url.Values{}
+	params.Set("action", "logout")
+	params.Set("username", d.Client.Username)
+	params.Set("ip", d.Client.GetLocalIP())
+	params.Set("ac_id", d.ACID)
+	res, err := d.get(ctx, "/cgi-bin/srun_portal", params)
+	if err != nil {
+		return err
+	}
+	if res.Error != "ok" && res.Res != "ok" {
+		return fmt.Errorf("logout failed: %s %s", res.Error, res.ErrorMsg)
+	}
+	return nil
+}
+
+// Status maps rad_user_info; sum_bytes is in bytes and sum_seconds in seconds.
+func (d *SrunDriver) Status(ctx context.Context) (*AccountStatus, error) {
+	res, err := d.get(ctx, "/cgi-bin/rad_user_info", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	st := &AccountStatus{Username: d.Client.Username, IP: d.Client.GetLocalIP(), Host: d.Client.host(), Raw: res}
+	if res.Error != "ok" {
+		return st, ErrNoStatusData
+	}
+	st.LoggedIn = true
+	if res.UserName != "" {
+		st.Username = res.UserName
+	}
+	if res.OnlineIP != "" {
+		st.IP = res.OnlineIP
+	}
+	bytesUsed, _ := res.SumBytes.Float64()
+	st.Used = ByteSize(bytesUsed)
+	st.OnlineSeconds, _ = res.SumSeconds.Int64()
+	st.Balance, _ = res.UserBalance.Float64()
+	return st, nil
+}
+
+func (d *SrunDriver) Probe(ctx context.Context) error {
+	_, _, err := d.challenge(ctx)
+	return err
+}
+
+func (d *SrunDriver) Hosts() []HostHealth {
+	return d.Client.Hosts()
+}
+
+func (d *SrunDriver) AddressChange() *AddressChange {
+	return d.Client.AddressChange()
+}
+
+func (d *SrunDriver) Handover(ctx context.Context, ch *AddressChange) error {
+	return handover(ctx, d, d.Client, ch)
+}
+
+// srunInfo builds the "{SRBX1}" info parameter.
+func srunInfo(username, password, ip, acid, token string) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		IP       string `json:"ip"`
+		ACID     string `json:"acid"`
+		EncVer   string `json:"enc_ver"`
+	}{username, password, ip, acid, "srun_bx1"})
+	if err != nil {
+		return "", err
+	}
+	plain := bytes.TrimRight(buf.Bytes(), "\n")
+	return "{SRBX1}" + srunBase64.EncodeToString(xEncode(plain, []byte(token))), nil
+}
+
+// xEncode is the XXTEA variant from the Srun portal JS. The plaintext
+// length is appended as an extra word before encryption.
+func xEncode(msg, key []byte) []byte {
+	if len(msg) == 0 {
+		return nil
+	}
+	v := append(bytesToWords(msg), uint32(len(msg)))
+	k := bytesToWords(key)
+	for len(k) < 4 {
+		k = append(k, 0)
+	}
+
+	n := len(v) - 1
+	z := v[n]
+	var y, m, e, d uint32
+	const delta = 0x9e3779b9
+	for q := 6 + 52/(n+1); q > 0; q-- {
+		d += delta
+		e = d >> 2 & 3
+		p := 0
+		for ; p < n; p++ {
+			y = v[p+1]
+			m = z>>5 ^ y<<2
+			m += (y>>3 ^ z<<4) ^ (d ^ y)
+			m += k[uint32(p&3)^e] ^ z
+			v[p] += m
+			z = v[p]
+		}
+		y = v[0]
+		m = z>>5 ^ y<<2
+		m += (y>>3 ^ z<<4) ^ (d ^ y)
+		m += k[uint32(p&3)^e] ^ z
+		v[n] += m
+		z = v[n]
+	}
+
+	out := make([]byte, 4*len(v))
+	for i, w := range v {
+		binary.LittleEndian.PutUint32(out[4*i:], w)
+	}
+	return out
+}
+
+// bytesToWords packs bytes into little-endian words, zero-padding the tail.
+func bytesToWords(b []byte) []uint32 {
+	padded := make([]byte, (len(b)+3)/4*4)
+	copy(padded, b)
+	words := make([]uint32, len(padded)/4)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(padded[4*i:])
+	}
+	return words
+}
@@ -0,0 +1,230 @@
+package drcom
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const srunToken = "8f5e3b2a1c9d7e6f0a1b2c3d4e5f6a7b"
+
+// xDecode reverses the Srun XXTEA variant and strips the length word.
+func xDecode(data, key []byte) ([]byte, error) {
+	if len(data)%4 != 0 || len(data) < 8 {
+		return nil, fmt.Errorf("bad ciphertext length %d", len(data))
+	}
+	v := make([]uint32, len(data)/4)
+	for i := range v {
+		v[i] = binary.LittleEndian.Uint32(data[4*i:])
+	}
+	kb := make([]byte, 16)
+	copy(kb, key)
+	var k [4]uint32
+	for i := range k {
+		k[i] = binary.LittleEndian.Uint32(kb[4*i:])
+	}
+	mx := func(z, y, d, key uint32) uint32 {
+		return (z>>5 ^ y<<2) + ((y>>3 ^ z<<4) ^ (d ^ y)) + (key ^ z)
+	}
+
+	const delta = 0x9e3779b9
+	n := len(v) - 1
+	rounds := 6 + 52/(n+1)
+	d := uint32(rounds) * delta
+	for ; rounds > 0; rounds-- {
+		e := d >> 2 & 3
+		for p := n; p > 0; p-- {
+			v[p] -= mx(v[p-1], v[(p+1)%(n+1)], d, k[uint32(p&3)^e])
+		}
+		v[0] -= mx(v[n], v[1], d, k[e])
+		d -= delta
+	}
+
+	size := int(v[n])
+	if size > 4*n {
+		return nil, fmt.Errorf("bad length word %d", size)
+	}
+	out := make([]byte, 4*n)
+	for i := 0; i < n; i++ {
+		binary.LittleEndian.PutUint32(out[4*i:], v[i])
+	}
+	return out[:size], nil
+}
+
+// srunServer is a stand-in Srun portal that verifies the login request
+// the way the portal backend does.
+type srunServer struct {
+	t        *testing.T
+	username string
+	password string
+	ip       string
+	acid     string
+	reply    map[string]interface{} // srun_portal answer to a valid login
+	loggedIn bool
+}
+
+func (s *srunServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var res interface{}
+	switch r.URL.Path {
+	case "/cgi-bin/get_challenge":
+		if q.Get("username") != s.username {
+			s.t.Errorf("get_challenge: username %q", q.Get("username"))
+		}
+		res = map[string]string{"challenge": srunToken, "client_ip": s.ip, "error": "ok"}
+	case "/cgi-bin/srun_portal":
+		if q.Get("action") == "logout" {
+			s.loggedIn = false
+			res = map[string]string{"error": "ok"}
+			break
+		}
+		s.checkLogin(q)
+		res = s.reply
+		if s.reply["error"] == "ok" {
+			s.loggedIn = true
+		}
+	case "/cgi-bin/rad_user_info":
+		if !s.loggedIn {
+			res = map[string]string{"error": "not_online_error"}
+			break
+		}
+		res = map[string]interface{}{
+			"error": "ok", "user_name": s.username, "online_ip": s.ip,
+			"sum_bytes": 1073741824, "sum_seconds": 3600, "user_balance": 12.5,
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	body, _ := json.Marshal(res)
+	fmt.Fprintf(w, "%s(%s)", q.Get("callback"), body)
+}
+
+// checkLogin runs on the server goroutine, so it reports with Errorf.
+func (s *srunServer) checkLogin(q url.Values) {
+	t := s.t
+	mac := hmac.New(md5.New, []byte(srunToken))
+	mac.Write([]byte(s.password))
+	hmd5 := hex.EncodeToString(mac.Sum(nil))
+	if q.Get("password") != "{MD5}"+hmd5 {
+		t.Errorf("password %q, want {MD5}%s", q.Get("password"), hmd5)
+	}
+
+	info := q.Get("info")
+	if !strings.HasPrefix(info, "{SRBX1}") {
+		t.Errorf("info %q lacks the {SRBX1} prefix", info)
+		return
+	}
+	alphabet := base64.NewEncoding("LVoJPiCN2R8G90yg+hmFHuacZ1OWMnrsSTXkYpUq/3dlbfKwv6xztjI7DeBE45QA")
+	raw, err := alphabet.DecodeString(info[len("{SRBX1}"):])
+	if err != nil {
+		t.Errorf("info: %v", err)
+		return
+	}
+	plain, err := xDecode(raw, []byte(srunToken))
+	if err != nil {
+		t.Errorf("info: %v", err)
+		return
+	}
+	var fields map[string]string
+	if err := json.Unmarshal(plain, &fields); err != nil {
+		t.Errorf("info %q: %v", plain, err)
+		return
+	}
+	want := map[string]string{"username": s.username, "password": s.password, "ip": s.ip, "acid": s.acid, "enc_ver": "srun_bx1"}
+	if fmt.Sprint(fields) != fmt.Sprint(want) {
+		t.Errorf("info %v, want %v", fields, want)
+	}
+
+	chk := srunToken + s.username + srunToken + hmd5 + srunToken + s.acid + srunToken + s.ip +
+		srunToken + "200" + srunToken + "1" + srunToken + info
+	sum := sha1.Sum([]byte(chk))
+	if q.Get("chksum") != hex.EncodeToString(sum[:]) {
+		t.Errorf("chksum %s, want %x", q.Get("chksum"), sum)
+	}
+	for k, v := range map[string]string{"ac_id": s.acid, "ip": s.ip, "n": "200", "type": "1", "double_stack": "0"} {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+}
+
+func newSrunTest(t *testing.T, reply map[string]interface{}) (*SrunDriver, *srunServer) {
+	s := &srunServer{
+		t:        t,
+		username: "20231234",
+		password: "p@ss wörd&=",
+		ip:       "10.20.30.40",
+		acid:     "5",
+		reply:    reply,
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	c := NewClient(srv.URL, s.username, s.password, WithIP("10.99.99.99"))
+	return NewSrunDriver(c, Settings{"ac_id": s.acid}), s
+}
+
+func TestSrunLoginFlow(t *testing.T) {
+	d, _ := newSrunTest(t, map[string]interface{}{"error": "ok", "suc_msg": "login_ok", "ecode": 0})
+	ctx := context.Background()
+
+	if _, err := d.Status(ctx); err != ErrNoStatusData {
+		t.Fatalf("status before login: %v", err)
+	}
+	res, err := d.Login(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Outcome != OutcomeSuccess || res.Message != "login_ok" {
+		t.Fatalf("login: %v %q", res.Outcome, res.Message)
+	}
+	st, err := d.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The client IP reported by get_challenge wins over the local one.
+	if !st.LoggedIn || st.IP != "10.20.30.40" || st.Used != 1<<30 || st.OnlineSeconds != 3600 || st.Balance != 12.5 {
+		t.Fatalf("status %+v", st)
+	}
+	if err := d.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSrunOutcomes(t *testing.T) {
+	tests := []struct {
+		reply map[string]interface{}
+		want  LoginOutcome
+	}{
+		{map[string]interface{}{"error": "ok", "suc_msg": "ip_already_online_error"}, OutcomeAlreadyOnline},
+		{map[string]interface{}{"error": "login_error", "error_msg": "E2620: You are already online.", "ecode": "E2620"}, OutcomeAlreadyOnline},
+		{map[string]interface{}{"error": "login_error", "error_msg": "E2531: User not found.", "ecode": "E2531"}, OutcomeWrongPassword},
+		{map[string]interface{}{"error": "login_error", "error_msg": "E2901: (Third party 1)bind_user2: ldap_bind error", "ecode": "E2901"}, OutcomeWrongPassword},
+		{map[string]interface{}{"error": "login_error", "error_msg": "E2616: Arrearage users.", "ecode": "E2616"}, OutcomeAccountArrears},
+		{map[string]interface{}{"error": "login_error", "error_msg": "E2606: User is disabled.", "ecode": "E2606"}, OutcomeAccountDisabled},
+		{map[string]interface{}{"error": "login_error", "error_msg": "E2532: The two authentication interval cannot be less than 3 seconds.", "ecode": "E2532"}, OutcomeRateLimited},
+		{map[string]interface{}{"error": "login_error", "error_msg": "E2833", "ecode": "E2833"}, OutcomeTooManyDevices},
+		{map[string]interface{}{"error": "login_error", "error_msg": "E9999: something new", "ecode": "E9999"}, OutcomeUnknown},
+	}
+	for _, tt := range tests {
+		d, _ := newSrunTest(t, tt.reply)
+		res, err := d.Login(context.Background())
+		if err != nil {
+			t.Fatalf("%v: %v", tt.reply, err)
+		}
+		if res.Outcome != tt.want {
+			t.Errorf("%v: outcome %v, want %v", tt.reply["error_msg"], res.Outcome, tt.want)
+		}
+	}
+}
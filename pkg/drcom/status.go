@@ -0,0 +1,110 @@
+package drcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrNoStatusData is returned when the portal answers without any account data,
+// which usually means the host is not logged in.
+var ErrNoStatusData = errors.New("no account data in status response")
+
+// ByteUnit selects decimal (1000) or binary (1024) multiples for display.
+type ByteUnit int
+
+const (
+	UnitDecimal ByteUnit = 1000
+	UnitBinary  ByteUnit = 1024
+)
+
+// ParseByteUnit accepts 1000 or 1024; anything else falls back to UnitBinary.
+func ParseByteUnit(base int) ByteUnit {
+	if base == int(UnitDecimal) {
+		return UnitDecimal
+	}
+	return UnitBinary
+}
+
+// ByteSize is a traffic quantity in bytes.
+type ByteSize int64
+
+func (b ByteSize) MB(u ByteUnit) float64 {
+	return float64(b) / float64(u) / float64(u)
+}
+
+func (b ByteSize) GB(u ByteUnit) float64 {
+	return b.MB(u) / float64(u)
+}
+
+// Format renders the size in MB below 1 GB and in GB above it.
+func (b ByteSize) Format(u ByteUnit) string {
+	if gb := b.GB(u); gb >= 1 {
+		return fmt.Sprintf("%.2f GB", gb)
+	}
+	return fmt.Sprintf("%.2f MB", b.MB(u))
+}
+
+// AccountStatus is the portal-independent view of the current session.
+type AccountStatus struct {
+	Username      string
+	Used          ByteSize
+	Balance       float64
+	OnlineSeconds int64
+	IP            string
+	IPv6          string // Set when the IP mode includes IPv6
+	Interface     string // Local interface used to reach the portal, if known
+	Host          string // Portal host (or UDP server) that answered
+	LoggedIn      bool
+	Raw           interface{} // Original portal payload
+}
+
+// NewAccountStatus normalizes both loadUserInfo shapes. The portal reports
+// USERFLOW in MB and user_info.userFlow in KB, both with 1024 multiples;
+// USERTIME is in minutes.
+func NewAccountStatus(res *UserInfoResponse) (*AccountStatus, error) {
+	st := &AccountStatus{Raw: res}
+	switch {
+	case len(res.Data) > 0:
+		d := res.Data[0]
+		st.Used = ByteSize(d.UserFlow * 1024 * 1024)
+		st.Balance = float64(d.UserMoney)
+		st.OnlineSeconds = int64(d.UserTime) * 60
+	case res.UserInfo.UserFlow != "":
+		flowKB, _ := strconv.ParseFloat(res.UserInfo.UserFlow.String(), 64)
+		st.Used = ByteSize(flowKB * 1024)
+		st.Balance, _ = strconv.ParseFloat(res.UserInfo.UserBalance.String(), 64)
+		st.Username = res.UserInfo.UserName.String()
+		if st.Username == "" {
+			st.Username = res.UserInfo.UserAccount.String()
+		}
+	default:
+		return st, ErrNoStatusData
+	}
+	st.LoggedIn = true
+	return st, nil
+}
+
+// AccountStatus fetches and normalizes the current session status.
+func (c *DrComClient) AccountStatus(ctx context.Context) (*AccountStatus, error) {
+	res, err := c.GetStatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st, err := NewAccountStatus(res)
+	if st.Username == "" {
+		st.Username = c.Username
+	}
+	if c.ipMode.V4() {
+		st.IP = c.GetLocalIP()
+	}
+	if c.ipMode.V6() {
+		st.IPv6 = c.GetLocalIPv6()
+	}
+	if la := c.LocalAddr(); la != nil {
+		st.Interface = la.Interface
+	}
+	st.Host = c.host()
+	return st, err
+}
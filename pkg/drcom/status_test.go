@@ -0,0 +1,78 @@
+package drcom
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewAccountStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		used    ByteSize
+		balance float64
+		seconds int64
+		user    string
+		err     error
+	}{
+		// data[].USERFLOW is in MB, USERTIME in minutes.
+		{"data in MB", `dr1({"result":1,"data":[{"USERFLOW":1536,"USERMONEY":12.5,"USERTIME":90}]})`, 1536 << 20, 12.5, 5400, "", nil},
+		{"data as strings", `dr1({"data":{"USERFLOW":"0.5","USERMONEY":"0","USERTIME":"1"}})`, 512 << 10, 0, 60, "", nil},
+		// user_info.userFlow is in KB and carries the account name.
+		{"user_info in KB", `{"result":1,"user_info":{"userAccount":"20230001","userName":"张三","userBalance":"8.80","userFlow":"2048"}}`, 2 << 20, 8.8, 0, "张三", nil},
+		{"user_info without name", `{"user_info":{"userAccount":20230001,"userName":null,"userBalance":3,"userFlow":1}}`, 1 << 10, 3, 0, "20230001", nil},
+		{"user_info bad numbers", `{"user_info":{"userAccount":"a","userBalance":"-","userFlow":"n/a"}}`, 0, 0, 0, "a", nil},
+		{"data wins", `{"data":[{"USERFLOW":1}],"user_info":{"userName":"x","userFlow":"4096"}}`, 1 << 20, 0, 0, "", nil},
+		{"empty data", `dr1({"result":0,"data":[]})`, 0, 0, 0, "", ErrNoStatusData},
+		{"nothing", `dr1({"result":0,"msg":"未登录"})`, 0, 0, 0, "", ErrNoStatusData},
+	}
+	for _, tt := range tests {
+		var res UserInfoResponse
+		if err := parseJSONP(tt.body, &res); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		st, err := NewAccountStatus(&res)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if st.LoggedIn != (tt.err == nil) {
+			t.Errorf("%s: LoggedIn %v", tt.name, st.LoggedIn)
+		}
+		if st.Used != tt.used || st.Balance != tt.balance || st.OnlineSeconds != tt.seconds || st.Username != tt.user {
+			t.Errorf("%s: used %d balance %v seconds %d user %q, want %d %v %d %q",
+				tt.name, st.Used, st.Balance, st.OnlineSeconds, st.Username, tt.used, tt.balance, tt.seconds, tt.user)
+		}
+		if st.Raw != &res {
+			t.Errorf("%s: Raw is not the response", tt.name)
+		}
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		size ByteSize
+		unit ByteUnit
+		want string
+	}{
+		{0, UnitBinary, "0.00 MB"},
+		{1536 << 10, UnitBinary, "1.50 MB"},
+		{1023 << 20, UnitBinary, "1023.00 MB"},
+		{1 << 30, UnitBinary, "1.00 GB"},
+		{5 << 29, UnitBinary, "2.50 GB"},
+		{1_500_000, UnitDecimal, "1.50 MB"},
+		// 1 GiB is more than a decimal GB.
+		{1 << 30, UnitDecimal, "1.07 GB"},
+		{999_990_000, UnitDecimal, "999.99 MB"},
+	}
+	for _, tt := range tests {
+		if got := tt.size.Format(tt.unit); got != tt.want {
+			t.Errorf("%d bytes in base %d: %q, want %q", tt.size, tt.unit, got, tt.want)
+		}
+	}
+	for base, want := range map[int]ByteUnit{1000: UnitDecimal, 1024: UnitBinary, 0: UnitBinary, 1: UnitBinary} {
+		if got := ParseByteUnit(base); got != want {
+			t.Errorf("ParseByteUnit(%d) = %d, want %d", base, got, want)
+		}
+	}
+}
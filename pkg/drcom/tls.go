@@ -0,0 +1,86 @@
+package drcom
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TLSOptions configures certificate checks for HTTPS portals.
+type TLSOptions struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string
+	// Pins are SHA-256 fingerprints of acceptable server certificates, hex
+	// with optional colons. A pinned certificate is accepted without chain
+	// validation, which is what makes self-signed portals work.
+	Pins []string
+	// InsecureSkipVerify disables all certificate checks.
+	InsecureSkipVerify bool
+}
+
+// Config builds the tls.Config, or nil when o is all defaults.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	if o.CAFile == "" && len(o.Pins) == 0 && !o.InsecureSkipVerify {
+		return nil, nil
+	}
+	conf := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CAFile != "" {
+		pemData, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+	if len(o.Pins) > 0 && !o.InsecureSkipVerify {
+		pins := make([][]byte, 0, len(o.Pins))
+		for _, p := range o.Pins {
+			b, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(p), ":", ""))
+			if err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("invalid SHA-256 pin %q", p)
+			}
+			pins = append(pins, b)
+		}
+		// Chain validation is replaced by the pin check below.
+		conf.InsecureSkipVerify = true
+		conf.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("no server certificate")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			for _, p := range pins {
+				if bytes.Equal(p, sum[:]) {
+					return nil
+				}
+			}
+			return fmt.Errorf("certificate fingerprint %x matches no pin", sum)
+		}
+	}
+	return conf, nil
+}
+
+// newTransport clones the default transport with optional interface
+// binding and TLS configuration.
+func newTransport(ifname string, tlsConf *tls.Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if ifname != "" {
+		t.DialContext = bindDialContext(ifname)
+	}
+	if tlsConf != nil {
+		t.TLSClientConfig = tlsConf.Clone()
+	}
+	return t
+}
@@ -0,0 +1,90 @@
+package drcom
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// colonHex formats a fingerprint the way browsers show it, AA:BB:...
+func colonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02X", c)
+	}
+	return strings.Join(parts, ":")
+}
+
+func TestTLSOptions(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	// Rejected handshakes are expected.
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	other := sha256.Sum256([]byte("another certificate"))
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o644)
+	emptyFile := filepath.Join(dir, "empty.pem")
+	os.WriteFile(emptyFile, []byte("not a certificate\n"), 0o644)
+
+	tests := []struct {
+		name      string
+		opts      TLSOptions
+		configErr bool
+		reqErr    string // Part of the request error, "" for success
+	}{
+		{"system roots", TLSOptions{}, false, "certificate"},
+		{"pin", TLSOptions{Pins: []string{fmt.Sprintf("%x", sum)}}, false, ""},
+		{"pin with colons", TLSOptions{Pins: []string{" " + colonHex(sum[:]) + " "}}, false, ""},
+		{"second pin", TLSOptions{Pins: []string{fmt.Sprintf("%x", other), fmt.Sprintf("%x", sum)}}, false, ""},
+		{"pin mismatch", TLSOptions{Pins: []string{fmt.Sprintf("%x", other)}}, false, fmt.Sprintf("%x matches no pin", sum)},
+		{"pin mismatch with CA", TLSOptions{CAFile: caFile, Pins: []string{fmt.Sprintf("%x", other)}}, false, "matches no pin"},
+		{"CA file", TLSOptions{CAFile: caFile}, false, ""},
+		{"insecure", TLSOptions{InsecureSkipVerify: true}, false, ""},
+		{"insecure ignores pins", TLSOptions{InsecureSkipVerify: true, Pins: []string{fmt.Sprintf("%x", other)}}, false, ""},
+		{"short pin", TLSOptions{Pins: []string{fmt.Sprintf("%x", sum[:20])}}, true, ""},
+		{"not hex", TLSOptions{Pins: []string{strings.Repeat("zz", 32)}}, true, ""},
+		{"missing CA file", TLSOptions{CAFile: filepath.Join(dir, "missing.pem")}, true, ""},
+		{"CA file without certificates", TLSOptions{CAFile: emptyFile}, true, ""},
+	}
+	if conf, err := (TLSOptions{}).Config(); conf != nil || err != nil {
+		t.Fatalf("defaults gave %v, %v; want no config", conf, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := tt.opts.Config()
+			if (err != nil) != tt.configErr {
+				t.Fatalf("config error %v, want error %v", err, tt.configErr)
+			}
+			if err != nil {
+				return
+			}
+			client := &http.Client{Transport: newTransport("", conf)}
+			req, _ := http.NewRequestWithContext(context.Background(), "GET", srv.URL, nil)
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			switch {
+			case tt.reqErr == "" && err != nil:
+				t.Fatalf("request: %v", err)
+			case tt.reqErr != "" && (err == nil || !strings.Contains(err.Error(), tt.reqErr)):
+				t.Fatalf("request error %v, want %q", err, tt.reqErr)
+			}
+		})
+	}
+}
@@ -1,35 +1,51 @@
 package drcom
 
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
 // Old structs (kept if needed, but defining new ones for current observation)
 
 type LoginResponse struct {
 	Result   interface{} `json:"result"`   // "1" or 1 usually means success
 	Msg      string      `json:"msg"`      // "登录成功"
 	RetCode  interface{} `json:"ret_code"` // 2 usually
+	// Every field of the response, including ones not mapped above
+	Fields map[string]interface{} `json:"-"`
 }
 
+func (r *LoginResponse) setFields(f map[string]interface{}) { r.Fields = f }
+
 // Updated based on actual response
 type UserInfoResponse struct {
-    Code string `json:"code"` // "1"
+    Code Text `json:"code"` // "1"
     Msg string `json:"msg"`
-    Data []UserData `json:"data"`
+    Data UserDataList `json:"data"` // Object or array, depending on the build
     // Keep old fields just in case it varies
 	Result    interface{} `json:"result"`
 	UserInfo  UserInfo    `json:"user_info"`
+	// Every field of the response, including ones not mapped above
+	Fields map[string]interface{} `json:"-"`
 }
 
+func (r *UserInfoResponse) setFields(f map[string]interface{}) { r.Fields = f }
+
 type UserData struct {
-    UserFlow float64 `json:"USERFLOW"` // It was number in JSON
-    UserMoney float64 `json:"USERMONEY"`
-    UserTime int `json:"USERTIME"`
+    UserFlow Number `json:"USERFLOW"` // It was number in JSON
+    UserMoney Number `json:"USERMONEY"`
+    UserTime Number `json:"USERTIME"`
 }
 
 type UserInfo struct {
-	UserIndex   string `json:"userIndex"`
-	UserAccount string `json:"userAccount"`
-	UserName    string `json:"userName"`
-	UserBalance string `json:"userBalance"`
-	UserFlow    string `json:"userFlow"`
+	UserIndex   Text `json:"userIndex"`
+	UserAccount Text `json:"userAccount"`
+	UserName    Text `json:"userName"`
+	UserBalance Text `json:"userBalance"`
+	UserFlow    Text `json:"userFlow"`
 }
 
 type DrComClient struct {
@@ -37,4 +53,30 @@ type DrComClient struct {
 	Username string
 	Password string
 	IP       string // Local IP
-}
\ No newline at end of file
+	IPv6     string // Local IPv6, used when the IP mode includes IPv6
+
+	httpClient *http.Client
+	timeout    time.Duration
+	transport  http.RoundTripper
+	userAgent  string
+	referer    string
+	logger     Logger
+	now        func() time.Time
+	classifier *Classifier
+	profile    Profile
+	iface      string
+	mac        net.HardwareAddr
+	local      *LocalAddr
+	ipMode     IPMode
+	acParams   map[string]string
+	pool       *hostPool
+	tlsConfig  *tls.Config
+	jar        http.CookieJar
+	preLogin   []PreLoginStep
+	// Addresses set by options are never re-detected
+	pinnedIP   bool
+	pinnedIPv6 bool
+	// Guards Host, IP, IPv6, local and profile, which change while
+	// requests run (caching, failover, encryption detection)
+	mu sync.Mutex
+}
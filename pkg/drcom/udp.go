@@ -0,0 +1,135 @@
+package drcom
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"net"
+	"time"
+)
+
+// udpSession is the request/reply transport shared by the Dr.COM UDP drivers.
+type udpSession struct {
+	server  string // host:port
+	iface   string // Optional interface to bind to, e.g. ppp0
+	localIP net.IP // Optional source address
+	timeout time.Duration
+
+	conn *net.UDPConn
+}
+
+func (u *udpSession) dial() (*net.UDPConn, error) {
+	if u.conn != nil {
+		return u.conn, nil
+	}
+	d, err := interfaceDialer(u.iface, "udp4")
+	if err != nil {
+		return nil, err
+	}
+	if u.localIP != nil {
+		d.LocalAddr = &net.UDPAddr{IP: u.localIP}
+	}
+	conn, err := d.Dial("udp4", u.server)
+	if err != nil {
+		return nil, err
+	}
+	u.conn = conn.(*net.UDPConn)
+	return u.conn, nil
+}
+
+// local returns the source address of the current socket.
+func (u *udpSession) local() net.IP {
+	if u.conn == nil {
+		return u.localIP
+	}
+	return u.conn.LocalAddr().(*net.UDPAddr).IP
+}
+
+func (u *udpSession) close() {
+	if u.conn != nil {
+		u.conn.Close()
+		u.conn = nil
+	}
+}
+
+// exchange sends pkt and waits for a reply accepted by want, retrying a few
+// times since UDP replies get lost.
+func (u *udpSession) exchange(ctx context.Context, pkt []byte, want func([]byte) bool) ([]byte, error) {
+	conn, err := u.dial()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1024)
+	var lastErr error
+	for attempt := 0; attempt < 3; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(pkt); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(u.timeout)
+		if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+			deadline = dl
+		}
+		conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			if want(buf[:n]) {
+				return append([]byte(nil), buf[:n]...), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no reply from %s: %v", u.server, lastErr)
+}
+
+// interfaceIP returns the first IPv4 (or IPv6 if v6) address of ifname.
+func interfaceIP(ifname string, v6 bool) (net.IP, error) {
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if (n.IP.To4() == nil) == v6 && !n.IP.IsLinkLocalUnicast() {
+			return n.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no usable address", ifname)
+}
+
+func md5sum(parts ...[]byte) []byte {
+	h := md5.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+func padTo(b []byte, n int) []byte {
+	out := make([]byte, n)
+	copy(out, b)
+	return out
+}
+
+func ip4(ip net.IP) []byte {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return make([]byte, 4)
+}
+
+func macBytes(mac net.HardwareAddr) []byte {
+	return padTo(mac, 6)
+}
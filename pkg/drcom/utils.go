@@ -1,19 +1,73 @@
 package drcom
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
 	"time"
 )
 
+// Reachability targets. The IPv6 one must have an AAAA record.
+const (
+	checkURL   = "https://www.baidu.com"
+	checkURLv6 = "https://mirrors.tuna.tsinghua.edu.cn/"
+)
+
+// Checker runs the connectivity checks, optionally bound to an interface
+// and with custom TLS settings (for campus CAs or TLS-intercepting
+// gateways).
+type Checker struct {
+	Interface string
+	TLS       *tls.Config
+}
+
 // CheckInternet attempts to connect to a reliable external website (Baidu)
 // to verify actual internet connectivity.
 func CheckInternet() bool {
+	return CheckInternetVia("")
+}
+
+// CheckInternetVia is CheckInternet with the probe bound to ifname
+// (empty for the default route).
+func CheckInternetVia(ifname string) bool {
+	return Checker{Interface: ifname}.Online()
+}
+
+// CheckInternetFamily checks reachability over one address family only,
+// so an IPv6 outage is not hidden by working IPv4 and vice versa.
+func CheckInternetFamily(ifname string, v6 bool) bool {
+	return Checker{Interface: ifname}.Family(v6)
+}
+
+// Online reports whether the internet is reachable over any family.
+func (k Checker) Online() bool {
+	return k.get("tcp", checkURL)
+}
+
+// Family reports whether the internet is reachable over IPv6 (v6) or IPv4.
+func (k Checker) Family(v6 bool) bool {
+	if v6 {
+		return k.get("tcp6", checkURLv6)
+	}
+	return k.get("tcp4", checkURL)
+}
+
+// get GETs target with connections forced onto network.
+func (k Checker) get(network, target string) bool {
 	client := http.Client{
 		Timeout: 3 * time.Second,
 	}
+	if k.Interface != "" || k.TLS != nil || network != "tcp" {
+		t := newTransport("", k.TLS)
+		t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return bindDialContext(k.Interface)(ctx, network, addr)
+		}
+		client.Transport = t
+	}
     // We use a HEAD request to save bandwidth if possible, but GET is safer for some captive portals
     // that might intercept HEAD differently. GET is robust.
-	resp, err := client.Get("https://www.baidu.com")
+	resp, err := client.Get(target)
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,168 @@
+package drcom
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DriverWeb is the legacy Dr.COM web gateway: form login on /0.htm, status
+// as JavaScript variables on / and logout via /F.htm.
+const DriverWeb = "drcom-web"
+
+func init() {
+	RegisterDriver(DriverWeb, func(cfg DriverConfig) (PortalDriver, error) {
+		return NewWebDriver(NewClient(cfg.Host, cfg.Username, cfg.Password, cfg.Options...), cfg.Settings), nil
+	})
+}
+
+var (
+	webVarRe  = regexp.MustCompile(`\b(time|flow|fee|uid|v4ip|v46ip)\s*=\s*'([^']*)'`)
+	webMsgRe  = regexp.MustCompile(`\bMsg\s*=\s*(\d+)`)
+	webMsgaRe = regexp.MustCompile(`\bmsga\s*=\s*'([^']*)'`)
+)
+
+// WebDriver implements PortalDriver for the legacy gateway.
+type WebDriver struct {
+	Client *DrComClient
+	// FormKey is the static 0MKKey field, "123456" on most gateways.
+	FormKey string
+}
+
+// NewWebDriver reads the optional form_key setting.
+func NewWebDriver(c *DrComClient, s Settings) *WebDriver {
+	return &WebDriver{Client: c, FormKey: s.String("form_key", "123456")}
+}
+
+func (d *WebDriver) Login(ctx context.Context) (*LoginResult, error) {
+	c := d.Client
+	form := url.Values{}
+	form.Set("DDDDD", c.Username)
+	form.Set("upass", c.Password)
+	form.Set("0MKKey", d.FormKey)
+	form.Set("R1", "0")
+	form.Set("R2", "")
+	form.Set("R6", "0")
+	form.Set("para", "00")
+	form.Set("v6ip", "")
+	body, err := c.send(ctx, "POST", c.host()+"/0.htm", form)
+	if err != nil {
+		return nil, err
+	}
+	return d.classify(body), nil
+}
+
+// classify interprets the HTML answer of /0.htm. Success pages say so in
+// plain text; failures set Msg (and sometimes msga) for the page script.
+func (d *WebDriver) classify(body string) *LoginResult {
+	res := &LoginResult{Raw: body}
+	if strings.Contains(body, "successfully logged") || strings.Contains(body, "登录成功") {
+		res.Outcome = OutcomeSuccess
+		res.Message = "登录成功"
+		return res
+	}
+	m := webMsgRe.FindStringSubmatch(body)
+	if m == nil {
+		res.Outcome = OutcomeUnknown
+		res.Message = "无法识别的登录页面"
+		return res
+	}
+	res.Code = m[1]
+	if a := webMsgaRe.FindStringSubmatch(body); a != nil {
+		res.Message = a[1]
+	}
+	var msg string
+	switch res.Code {
+	case "01":
+		res.Outcome, msg = OutcomeWrongPassword, "账号或密码不对"
+	case "02":
+		res.Outcome, msg = OutcomeTooManyDevices, "该账号正在使用中"
+	case "03", "11":
+		res.Outcome, msg = OutcomePortalError, "本账号只能在指定地址使用"
+	case "04":
+		res.Outcome, msg = OutcomeAccountArrears, "本账号费用超支或时长流量超过限制"
+	case "05":
+		res.Outcome, msg = OutcomeAccountDisabled, "本账号暂停使用"
+	case "06":
+		res.Outcome, msg = OutcomePortalError, "系统缓存已满"
+	case "15":
+		res.Outcome, msg = OutcomeSuccess, "登录成功"
+	default:
+		// Let the configurable rules have a go at msga.
+		res.Outcome = d.Client.classifier.Match(res.Code, res.Message)
+	}
+	if res.Message == "" {
+		res.Message = msg
+	}
+	return res
+}
+
+func (d *WebDriver) Logout(ctx context.Context) error {
+	_, err := d.Client.doRequest(ctx, d.Client.host()+"/F.htm")
+	return err
+}
+
+// Status scrapes the root page. time is in minutes, flow in KB and fee in
+// units of 0.0001 yuan.
+func (d *WebDriver) Status(ctx context.Context) (*AccountStatus, error) {
+	body, err := d.Client.doRequest(ctx, d.Client.host()+"/")
+	if err != nil {
+		return nil, err
+	}
+	vars := parseWebVars(body)
+	st := &AccountStatus{
+		Username: d.Client.Username,
+		IP:       d.Client.GetLocalIP(),
+		Host:     d.Client.host(),
+		Raw:      vars,
+	}
+	flow, ok := vars["flow"]
+	if !ok {
+		return st, ErrNoStatusData
+	}
+	st.LoggedIn = true
+	if uid := vars["uid"]; uid != "" {
+		st.Username = uid
+	}
+	if ip := vars["v4ip"]; ip != "" {
+		st.IP = ip
+	} else if ip := vars["v46ip"]; ip != "" {
+		st.IP = ip
+	}
+	flowKB, _ := strconv.ParseFloat(flow, 64)
+	st.Used = ByteSize(flowKB * 1024)
+	fee, _ := strconv.ParseFloat(vars["fee"], 64)
+	st.Balance = fee / 10000
+	minutes, _ := strconv.ParseInt(vars["time"], 10, 64)
+	st.OnlineSeconds = minutes * 60
+	return st, nil
+}
+
+func (d *WebDriver) Probe(ctx context.Context) error {
+	_, err := d.Client.doRequest(ctx, d.Client.host()+"/")
+	return err
+}
+
+func (d *WebDriver) Hosts() []HostHealth {
+	return d.Client.Hosts()
+}
+
+func (d *WebDriver) AddressChange() *AddressChange {
+	return d.Client.AddressChange()
+}
+
+func (d *WebDriver) Handover(ctx context.Context, ch *AddressChange) error {
+	return handover(ctx, d, d.Client, ch)
+}
+
+// parseWebVars extracts the status variables (time, flow, fee, uid, ...)
+// assigned by the gateway's root page script.
+func parseWebVars(body string) map[string]string {
+	vars := make(map[string]string)
+	for _, m := range webVarRe.FindAllStringSubmatch(body, -1) {
+		vars[m[1]] = strings.TrimSpace(m[2])
+	}
+	return vars
+}
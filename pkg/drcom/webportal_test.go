@@ -0,0 +1,133 @@
+package drcom
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestWebClassify(t *testing.T) {
+	d := NewWebDriver(NewClient("", "u", "p", WithOutcomeRules(OutcomeRule{Msg: "维护", Outcome: OutcomeRateLimited})), Settings{})
+	tests := []struct {
+		name string
+		body string
+		want LoginOutcome
+		code string
+		msg  string
+	}{
+		{"success text", `<title>登录成功窗</title><p>您已经成功登录。登录成功</p>`, OutcomeSuccess, "", "登录成功"},
+		{"success english", `You have successfully logged into our system.`, OutcomeSuccess, "", "登录成功"},
+		{"wrong password", `<script>Msg=01;time='0';</script>`, OutcomeWrongPassword, "01", "账号或密码不对"},
+		{"in use", `<script>Msg=02;</script>`, OutcomeTooManyDevices, "02", "该账号正在使用中"},
+		{"bound address", `<script>Msg=11;</script>`, OutcomePortalError, "11", "本账号只能在指定地址使用"},
+		{"arrears", `<script>Msg=04;</script>`, OutcomeAccountArrears, "04", "本账号费用超支或时长流量超过限制"},
+		{"suspended", `<script>Msg=05;</script>`, OutcomeAccountDisabled, "05", "本账号暂停使用"},
+		{"cache full", `<script>Msg=06;</script>`, OutcomePortalError, "06", "系统缓存已满"},
+		{"msga kept", `<script>Msg=01;msga='ldap auth error';</script>`, OutcomeWrongPassword, "01", "ldap auth error"},
+		{"already online", `<script>Msg=15;</script>`, OutcomeSuccess, "15", "登录成功"},
+		{"msga through the rules", `<script>Msg=14;msga='系统维护中';</script>`, OutcomeRateLimited, "14", "系统维护中"},
+		{"unknown code", `<script>Msg=99;</script>`, OutcomeUnknown, "99", ""},
+		{"no script", `<html>Bad Gateway</html>`, OutcomeUnknown, "", "无法识别的登录页面"},
+	}
+	for _, tt := range tests {
+		res := d.classify(tt.body)
+		if res.Outcome != tt.want || res.Code != tt.code || res.Message != tt.msg {
+			t.Errorf("%s: %v %q %q, want %v %q %q", tt.name, res.Outcome, res.Code, res.Message, tt.want, tt.code, tt.msg)
+		}
+	}
+}
+
+func TestParseWebVars(t *testing.T) {
+	body := `<script>time='125      ';flow='2048     ';fsele=1;fee='123400   ';xsele=0;xip='000.000.000.000.';
+mtime='';uid='20230001';v4ip='10.1.2.3';v46ip='';Utime='x';</script>`
+	vars := parseWebVars(body)
+	want := map[string]string{"time": "125", "flow": "2048", "fee": "123400", "uid": "20230001", "v4ip": "10.1.2.3", "v46ip": ""}
+	if len(vars) != len(want) {
+		t.Fatalf("vars %v, want %v", vars, want)
+	}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("%s = %q, want %q", k, vars[k], v)
+		}
+	}
+}
+
+// webGateway is a stand-in legacy gateway. Its pages are GBK encoded, like
+// the real ones.
+func webGateway(t *testing.T) (*httptest.Server, *bool) {
+	online := new(bool)
+	gbk := func(w http.ResponseWriter, s string) {
+		b, _ := simplifiedchinese.GBK.NewEncoder().String(s)
+		w.Header().Set("Content-Type", "text/html; charset=gbk")
+		w.Write([]byte(b))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0.htm":
+			if r.Method != "POST" {
+				t.Errorf("login with %s", r.Method)
+			}
+			r.ParseForm()
+			if r.PostForm.Get("DDDDD") != "20230001" || r.PostForm.Get("0MKKey") != "654321" {
+				t.Errorf("login form %v", r.PostForm)
+			}
+			if r.PostForm.Get("upass") != "secret" {
+				gbk(w, `<script>Msg=01;msga='';</script>`)
+				return
+			}
+			*online = true
+			gbk(w, `<p>您已经成功登录。</p><p>登录成功</p>`)
+		case "/":
+			if !*online {
+				gbk(w, `<title>上网登录页</title><form action="0.htm"></form>`)
+				return
+			}
+			gbk(w, `<title>注销页</title><script>time='90  ';flow='3072  ';fee='85000 ';uid='20230001';v4ip='10.1.2.3';</script>`)
+		case "/F.htm":
+			*online = false
+			gbk(w, `<script>Msg=14;</script>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, online
+}
+
+func TestWebDriver(t *testing.T) {
+	srv, online := webGateway(t)
+	ctx := context.Background()
+	driver := func(password string) *WebDriver {
+		return NewWebDriver(NewClient(srv.URL, "20230001", password, WithIP("10.0.0.9")), Settings{"form_key": "654321"})
+	}
+
+	if _, err := driver("secret").Status(ctx); !errors.Is(err, ErrNoStatusData) {
+		t.Fatalf("status before login: %v", err)
+	}
+	res, err := driver("wrong").Login(ctx)
+	if err != nil || res.Outcome != OutcomeWrongPassword || res.Message != "账号或密码不对" {
+		t.Fatalf("wrong password: %+v, %v", res, err)
+	}
+	d := driver("secret")
+	if res, err := d.Login(ctx); err != nil || res.Outcome != OutcomeSuccess {
+		t.Fatalf("login: %+v, %v", res, err)
+	}
+	st, err := d.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	// time is in minutes, flow in KB and fee in 0.0001 yuan.
+	if !st.LoggedIn || st.Used != 3<<20 || st.Balance != 8.5 || st.OnlineSeconds != 5400 || st.IP != "10.1.2.3" || st.Username != "20230001" {
+		t.Fatalf("status %+v", st)
+	}
+	if err := d.Logout(ctx); err != nil || *online {
+		t.Fatalf("logout: %v, online %v", err, *online)
+	}
+	if err := d.Probe(ctx); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+}